@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/api"
+	"github.com/iwajezhgf/todo-backend/hasher"
+	"github.com/iwajezhgf/todo-backend/passwords"
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/storage/sqldb"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+// adminStores are the stores the admin commands work on.
+type adminStores struct {
+	todos          storage.TodoStore
+	tokens         storage.TokenStore
+	personalTokens storage.PersonalTokenStore
+	impersonations storage.ImpersonationStore
+	authEvents     storage.AuthEventStore
+	users          storage.UserStore
+}
+
+func openAdminStores(c config) (*adminStores, error) {
+	db, err := openDB(c.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	return &adminStores{
+		todos:          &sqldb.TodoStorage{Storage: db},
+		tokens:         &sqldb.TokenStorage{Storage: db},
+		personalTokens: &sqldb.PersonalTokenStorage{Storage: db},
+		impersonations: &sqldb.ImpersonationStorage{Storage: db},
+		authEvents:     &sqldb.AuthEventStorage{Storage: db},
+		users:          &sqldb.UserStorage{Storage: db},
+	}, nil
+}
+
+func runUser(c config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: user create|reset-password|set-role|delete --email <email>")
+	}
+
+	fs := flag.NewFlagSet("user "+args[0], flag.ContinueOnError)
+	email := fs.String("email", "", "email of the user")
+	password := fs.String("password", "", "new password, read from stdin when empty")
+	role := fs.String("role", "", "role to give the user: user, support or admin")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("--email is required")
+	}
+
+	st, err := openAdminStores(c)
+	if err != nil {
+		return err
+	}
+
+	h, err := newHasher(c.Auth.Password)
+	if err != nil {
+		return err
+	}
+	policy, err := passwordPolicy(c.Auth.Password)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		if _, err = st.users.GetByEmail(*email); err == nil {
+			return fmt.Errorf("user %s already exists", *email)
+		}
+
+		hashedPassword, err := readAndHashPassword(h, policy, *email, *password)
+		if err != nil {
+			return err
+		}
+		if err = st.users.Create(*email, hashedPassword); err != nil {
+			return err
+		}
+
+		// Accounts created by an administrator need no email verification.
+		u, err := st.users.GetByEmail(*email)
+		if err != nil {
+			return err
+		}
+		if err = st.users.Verify(u.ID, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		fmt.Println("created user", *email)
+		return nil
+	case "reset-password":
+		u, err := st.users.GetByEmail(*email)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", *email, err)
+		}
+
+		hashedPassword, err := readAndHashPassword(h, policy, *email, *password)
+		if err != nil {
+			return err
+		}
+		if err = st.users.EditPassword(u.ID, hashedPassword); err != nil {
+			return err
+		}
+
+		fmt.Println("password changed for", u.Email)
+		return nil
+	case "set-role":
+		if !api.ValidRole(*role) {
+			return errors.New("--role must be user, support or admin")
+		}
+
+		u, err := st.users.GetByEmail(*email)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", *email, err)
+		}
+		if err = st.users.SetRole(u.ID, *role); err != nil {
+			return err
+		}
+
+		fmt.Printf("%s is now %s\n", u.Email, *role)
+		return nil
+	case "delete":
+		u, err := st.users.GetByEmail(*email)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", *email, err)
+		}
+		if err = st.users.Delete(u.ID); err != nil {
+			return err
+		}
+
+		fmt.Println("deleted user", u.Email)
+		return nil
+	default:
+		return fmt.Errorf("unknown user command %q", args[0])
+	}
+}
+
+func runToken(c config, args []string) error {
+	if len(args) == 0 || args[0] != "revoke" {
+		return errors.New("usage: token revoke --user <email>")
+	}
+
+	fs := flag.NewFlagSet("token revoke", flag.ContinueOnError)
+	email := fs.String("user", "", "email of the user whose tokens are revoked")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("--user is required")
+	}
+
+	st, err := openAdminStores(c)
+	if err != nil {
+		return err
+	}
+
+	u, err := st.users.GetByEmail(*email)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", *email, err)
+	}
+
+	// Revoke the same way POST /api/admin/users/{id}/logout does, which also
+	// denies JWTs, deletes personal access tokens and ends impersonations.
+	s := api.Server{
+		Tokens:         st.tokens,
+		PersonalTokens: st.personalTokens,
+		Impersonations: st.impersonations,
+		AuthEvents:     st.authEvents,
+		Users:          st.users,
+		Auth: api.AuthConfig{
+			Mode: c.Auth.Mode,
+			JWT:  apiJWTConfig(c.Auth.JWT),
+		},
+	}
+	n, err := s.LogoutEverywhere(u)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %d sessions, tokens and impersonations of %s\n", n, u.Email)
+	return nil
+}
+
+func runTodos(c config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: todos export --user <email> | todos recompute-status")
+	}
+
+	switch args[0] {
+	case "export":
+		fs := flag.NewFlagSet("todos export", flag.ContinueOnError)
+		email := fs.String("user", "", "email of the user whose todos are exported")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if *email == "" {
+			return errors.New("--user is required")
+		}
+
+		st, err := openAdminStores(c)
+		if err != nil {
+			return err
+		}
+
+		u, err := st.users.GetByEmail(*email)
+		if err != nil {
+			return fmt.Errorf("user %s: %w", *email, err)
+		}
+
+		todos, err := st.todos.GetAllByUser(u.ID)
+		if err != nil {
+			return err
+		}
+
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(struct {
+			User  types.User   `json:"user"`
+			Todos []types.Todo `json:"todos"`
+		}{*u, todos})
+	case "recompute-status":
+		st, err := openAdminStores(c)
+		if err != nil {
+			return err
+		}
+
+		n, err := st.todos.RecomputeStatus()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("updated status of %d todos\n", n)
+		return nil
+	default:
+		return fmt.Errorf("unknown todos command %q", args[0])
+	}
+}
+
+// readAndHashPassword checks password against the policy and hashes it,
+// reading it from the first line of stdin when it is empty so it does not
+// have to appear in the shell history.
+func readAndHashPassword(h *hasher.Hasher, policy passwords.Policy, email, password string) ([]byte, error) {
+	if password == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return nil, errors.New("no password given on stdin")
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return nil, errors.New("password must not be empty")
+	}
+	if err := policy.Check(password, email); err != nil {
+		return nil, err
+	}
+
+	return h.Hash(password)
+}
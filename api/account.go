@@ -0,0 +1,161 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/valyala/fasthttp"
+)
+
+type deleteAccount struct {
+	Password string `json:"password"`
+}
+
+type deleteAccountResponse struct {
+	DeleteAfter time.Time `json:"delete_after"`
+}
+
+func (s *Server) handleDeleteAccount(ctx *fasthttp.RequestCtx) {
+	var da deleteAccount
+	json.Unmarshal(ctx.PostBody(), &da)
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	keys := s.attemptKeys(ctx, u.Email)
+	if !s.checkLockout(ctx, keys) {
+		return
+	}
+
+	if !s.checkPassword(da.Password, u.Password) {
+		s.failAttempt(keys)
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCredentials)
+		return
+	}
+
+	if s.Auth.DeletionGracePeriod <= 0 {
+		// Deny the user's JWTs before the sessions they refer to are gone.
+		if _, err = s.revokeOtherSessions(u.ID, 0); err == nil {
+			err = s.Users.Delete(u.ID)
+		}
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return
+		}
+
+		okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+		return
+	}
+
+	deleteAfter := time.Now().UTC().Add(s.Auth.DeletionGracePeriod)
+	err = s.Users.ScheduleDeletion(u.ID, &deleteAfter)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	inZone(userLocation(u), &deleteAfter)
+
+	go s.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf(
+			"Your account and all of its todos will be deleted on %s.\n\n"+
+				"If you change your mind, log in and restore the account before then.",
+			deleteAfter.Format("2006-01-02 15:04 MST"),
+		),
+	})
+
+	okResponse(ctx, fasthttp.StatusOK, deleteAccountResponse{DeleteAfter: deleteAfter})
+}
+
+func (s *Server) handleRestoreAccount(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	if u.DeleteAfter == nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Account is not scheduled for deletion", "")
+		return
+	}
+
+	err = s.Users.ScheduleDeletion(u.ID, nil)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+// handleExportAccount returns a ZIP with everything stored about the user.
+func (s *Server) handleExportAccount(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	todos, err := s.Todos.GetAllByUser(u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	sessions, err := s.Tokens.GetAllByUser(u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	loc := userLocation(u)
+	inZoneOptional(loc, &u.VerifiedAt, &u.DeleteAfter)
+	for i := range todos {
+		inZone(loc, &todos[i].Created, &todos[i].Expire)
+	}
+	for i := range sessions {
+		t := &sessions[i]
+		inZone(loc, &t.Created, &t.LastUsed, &t.Expire)
+		inZoneOptional(loc, &t.SessionExpire)
+	}
+
+	now := time.Now()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, f := range []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", u},
+		{"todos.json", todos},
+		{"sessions.json", sessions},
+	} {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			err = enc.Encode(f.data)
+		}
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return
+		}
+	}
+	if err = zw.Close(); err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	ctx.SetContentType("application/zip")
+	ctx.Response.Header.Set("Content-Disposition", `attachment; filename="todo-export.zip"`)
+	ctx.SetStatusCode(fasthttp.StatusOK)
+	ctx.SetBody(buf.Bytes())
+}
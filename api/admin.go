@@ -0,0 +1,278 @@
+package api
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+// Permissions checked by onlyPermitted.
+const (
+	PermUsersRead      = "users:read"
+	PermUsersWrite     = "users:write"
+	PermSessionsRevoke = "sessions:revoke"
+	PermUsageRead      = "usage:read"
+	PermImpersonate    = "users:impersonate"
+	PermAuthEventsRead = "auth_events:read"
+)
+
+// rolePermissions lists what each role may do besides using its own
+// account. Users have no extra permissions.
+var rolePermissions = map[string][]string{
+	types.RoleAdmin:   {PermUsersRead, PermUsersWrite, PermSessionsRevoke, PermUsageRead, PermImpersonate, PermAuthEventsRead},
+	types.RoleSupport: {PermUsersRead, PermSessionsRevoke, PermUsageRead, PermImpersonate, PermAuthEventsRead},
+}
+
+// ValidRole reports whether role is one of the roles in package types.
+func ValidRole(role string) bool {
+	return role == types.RoleUser || role == types.RoleSupport || role == types.RoleAdmin
+}
+
+// onlyPermitted lets through requests of users whose role grants perm. It
+// goes after onlyAuthorized.
+func (s *Server) onlyPermitted(perm string) func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			u, err := s.getUserByToken(ctx)
+			if err != nil {
+				errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+				return
+			}
+			if !hasScope(rolePermissions[u.Role], perm) {
+				errorResponse(ctx, fasthttp.StatusForbidden, "Forbidden", Forbidden)
+				return
+			}
+
+			next(ctx)
+		}
+	}
+}
+
+func (s *Server) handleAdminListUsers(ctx *fasthttp.RequestCtx) {
+	args := ctx.QueryArgs()
+	limit := args.GetUintOrZero("limit")
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	page := args.GetUintOrZero("page")
+	if page <= 0 {
+		page = 1
+	}
+
+	users, err := s.Users.Search(strings.TrimSpace(string(args.Peek("query"))), page, limit)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, users)
+}
+
+type adminUserResponse struct {
+	types.User
+	Usage types.Usage `json:"usage"`
+}
+
+func (s *Server) handleAdminGetUser(ctx *fasthttp.RequestCtx) {
+	u, ok := s.adminTarget(ctx)
+	if !ok {
+		return
+	}
+
+	usage, err := s.Users.Usage(u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, adminUserResponse{User: *u, Usage: *usage})
+}
+
+func (s *Server) handleAdminDisableUser(ctx *fasthttp.RequestCtx) {
+	u, admin, ok := s.manageTarget(ctx)
+	if !ok {
+		return
+	}
+	if admin.ID == u.ID {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "You cannot disable your own account", "")
+		return
+	}
+
+	if u.DisabledAt == nil {
+		now := time.Now().UTC()
+		if err := s.Users.SetDisabled(u.ID, &now); err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return
+		}
+
+		// Counting after the change catches two admins disabling each other
+		// at the same time; at least one of them gets the account back.
+		if u.Role == types.RoleAdmin {
+			admins, err := s.Users.CountEnabled(types.RoleAdmin)
+			if err != nil {
+				_ = s.Users.SetDisabled(u.ID, nil)
+				errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+				return
+			}
+			if admins == 0 {
+				_ = s.Users.SetDisabled(u.ID, nil)
+				errorResponse(ctx, fasthttp.StatusBadRequest, "The last admin cannot be disabled", "")
+				return
+			}
+		}
+		u.DisabledAt = &now
+	}
+
+	// Requests of a disabled user are refused anyway, but enabling the account
+	// again should not bring back its old sessions.
+	if _, err := s.logoutEverywhere(ctx, u, admin.ID); err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, u)
+}
+
+func (s *Server) handleAdminEnableUser(ctx *fasthttp.RequestCtx) {
+	u, _, ok := s.manageTarget(ctx)
+	if !ok {
+		return
+	}
+
+	if err := s.Users.SetDisabled(u.ID, nil); err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	u.DisabledAt = nil
+
+	okResponse(ctx, fasthttp.StatusOK, u)
+}
+
+func (s *Server) handleAdminLogoutUser(ctx *fasthttp.RequestCtx) {
+	u, admin, ok := s.manageTarget(ctx)
+	if !ok {
+		return
+	}
+
+	n, err := s.logoutEverywhere(ctx, u, admin.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]int64{"revoked": n})
+}
+
+// logoutEverywhere revokes every session and personal access token of the
+// user and ends the impersonations started by or acting as them, on behalf of
+// adminId. It returns how many of them were revoked or ended.
+func (s *Server) logoutEverywhere(ctx *fasthttp.RequestCtx, u *types.User, adminId uint64) (int64, error) {
+	sessions, err := s.revokeOtherSessions(u.ID, 0)
+	if err != nil {
+		return 0, err
+	}
+	if sessions > 0 {
+		s.recordEvent(ctx, u.ID, u.Email, types.EventSessionRevoke, "")
+	}
+
+	tokens, err := s.PersonalTokens.DeleteByUser(u.ID)
+	if err != nil {
+		return 0, err
+	}
+	if tokens > 0 {
+		s.recordEvent(ctx, u.ID, u.Email, types.EventPersonalTokenRevoke, "")
+	}
+
+	now := time.Now().UTC()
+	imps, err := s.Impersonations.GetActiveByUser(u.ID, now)
+	if err != nil {
+		return 0, err
+	}
+	var ended int64
+	for i := range imps {
+		ok, err := s.Impersonations.End(imps[i].ID, now)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			imps[i].Ended = &now
+			s.recordImpersonation(&imps[i], adminId, types.AuditStop, nil)
+			ended++
+		}
+	}
+
+	return sessions + tokens + ended, nil
+}
+
+// LogoutEverywhere is logoutEverywhere for the admin commands, which have no
+// request or logged in admin; the impersonations it ends are audited with
+// admin ID 0.
+func (s *Server) LogoutEverywhere(u *types.User) (int64, error) {
+	if err := s.setupAuthMode(); err != nil {
+		return 0, err
+	}
+
+	return s.logoutEverywhere(nil, u, 0)
+}
+
+func (s *Server) handleAdminUsage(ctx *fasthttp.RequestCtx) {
+	usage, err := s.Users.TotalUsage()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, usage)
+}
+
+// roleRank orders the roles by how much they may do.
+var roleRank = map[string]int{types.RoleUser: 0, types.RoleSupport: 1, types.RoleAdmin: 2}
+
+// canManage reports whether actor may change the account of target. Admins
+// may change every account, other roles only those of lower roles.
+func canManage(actor, target *types.User) bool {
+	return actor.Role == types.RoleAdmin || roleRank[target.Role] < roleRank[actor.Role]
+}
+
+// manageTarget loads the user named by the id route parameter and the user
+// acting on them, or responds with an error and returns false when the actor
+// may not change that account.
+func (s *Server) manageTarget(ctx *fasthttp.RequestCtx) (target, actor *types.User, ok bool) {
+	target, ok = s.adminTarget(ctx)
+	if !ok {
+		return nil, nil, false
+	}
+
+	actor, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return nil, nil, false
+	}
+	if !canManage(actor, target) {
+		errorResponse(ctx, fasthttp.StatusForbidden, "Forbidden", Forbidden)
+		return nil, nil, false
+	}
+
+	return target, actor, true
+}
+
+// adminTarget loads the user named by the id route parameter, or responds
+// with an error and returns false.
+func (s *Server) adminTarget(ctx *fasthttp.RequestCtx) (*types.User, bool) {
+	id, err := strconv.ParseUint(ctx.UserValue("id").(string), 10, 64)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid ID", "")
+		return nil, false
+	}
+
+	u, err := s.Users.GetById(id)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusNotFound, "", NotFound)
+		return nil, false
+	}
+
+	return u, true
+}
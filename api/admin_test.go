@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+func TestAdminTargetRank(t *testing.T) {
+	ts := newTestServer(t, nil)
+	admin, adminToken := ts.createUser(t, "admin@example.com", types.RoleAdmin, true)
+	other, _ := ts.createUser(t, "other-admin@example.com", types.RoleAdmin, true)
+	support, supportToken := ts.createUser(t, "support@example.com", types.RoleSupport, true)
+	colleague, _ := ts.createUser(t, "colleague@example.com", types.RoleSupport, true)
+	user, _ := ts.createUser(t, "ann@example.com", "", true)
+
+	path := func(u *types.User, action string) string {
+		return "/api/admin/users/" + strconv.FormatUint(u.ID, 10) + "/" + action
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		path   string
+		status int
+	}{
+		{"support logs out a user", supportToken, path(user, "logout"), 200},
+		{"support logs out support", supportToken, path(colleague, "logout"), 403},
+		{"support logs out an admin", supportToken, path(admin, "logout"), 403},
+		{"support disables a user", supportToken, path(user, "disable"), 403},
+		{"admin logs out an admin", adminToken, path(other, "logout"), 200},
+		{"admin disables an admin", adminToken, path(other, "disable"), 200},
+		{"admin enables an admin", adminToken, path(other, "enable"), 200},
+		{"admin logs out support", adminToken, path(support, "logout"), 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if r := ts.do(t, "POST", tt.path, tt.token, nil); r.status != tt.status {
+				t.Errorf("POST %s = %d %s, want %d", tt.path, r.status, r.body, tt.status)
+			}
+		})
+	}
+
+	t.Run("support ends an admin's impersonation", func(t *testing.T) {
+		supportToken := ts.newSession(t, support.ID)
+		r := ts.do(t, "POST", path(user, "impersonate"), adminToken, map[string]string{})
+		if r.status != 201 {
+			t.Fatalf("impersonate = %d %s", r.status, r.body)
+		}
+		var imp impersonationResponse
+		if err := json.Unmarshal(r.body, &imp); err != nil {
+			t.Fatal(err)
+		}
+
+		stop := "/api/admin/impersonations/" + strconv.FormatUint(imp.ID, 10) + "/stop"
+		if r = ts.do(t, "POST", stop, supportToken, nil); r.status != 403 {
+			t.Errorf("POST %s by support = %d %s, want 403", stop, r.status, r.body)
+		}
+		if r = ts.do(t, "GET", "/api/profile", imp.Token, nil); r.status != 200 {
+			t.Errorf("impersonation after the refused stop = %d %s, want 200", r.status, r.body)
+		}
+		if r = ts.do(t, "POST", path(admin, "logout"), supportToken, nil); r.status != 403 {
+			t.Errorf("support logging out the impersonating admin = %d, want 403", r.status)
+		}
+		if r = ts.do(t, "GET", "/api/profile", imp.Token, nil); r.status != 200 {
+			t.Errorf("impersonation after the refused logout = %d %s, want 200", r.status, r.body)
+		}
+	})
+}
+
+// racingDisable disables the acting admin as well whenever they disable
+// someone else, as if another admin had disabled them at the same moment.
+type racingDisable struct {
+	storage.UserStore
+	actorId uint64
+}
+
+func (r racingDisable) SetDisabled(userId uint64, at *time.Time) error {
+	if at != nil && userId != r.actorId {
+		if err := r.UserStore.SetDisabled(r.actorId, at); err != nil {
+			return err
+		}
+	}
+
+	return r.UserStore.SetDisabled(userId, at)
+}
+
+// TestLastAdminStaysEnabled has two admins disable each other at the same
+// time, which must not leave the service without an enabled admin.
+func TestLastAdminStaysEnabled(t *testing.T) {
+	ts := newTestServer(t, nil)
+	a, aToken := ts.createUser(t, "a@example.com", types.RoleAdmin, true)
+	b, _ := ts.createUser(t, "b@example.com", types.RoleAdmin, true)
+	ts.Users = racingDisable{UserStore: ts.Users, actorId: a.ID}
+
+	path := "/api/admin/users/" + strconv.FormatUint(b.ID, 10) + "/disable"
+	if r := ts.do(t, "POST", path, aToken, nil); r.status != 400 {
+		t.Errorf("POST %s = %d %s, want 400", path, r.status, r.body)
+	}
+	if n, err := ts.Users.CountEnabled(types.RoleAdmin); err != nil || n != 1 {
+		t.Errorf("CountEnabled(admin) = %d, %v, want 1", n, err)
+	}
+}
+
+func TestLogoutEverywhereCommand(t *testing.T) {
+	ts := newTestServer(t, nil)
+	_, adminToken := ts.createUser(t, "admin@example.com", types.RoleAdmin, true)
+	u, token := ts.createUser(t, "ann@example.com", "", true)
+
+	expire := time.Now().UTC().Add(time.Hour)
+	if err := ts.PersonalTokens.Create(personalTokenPrefix+"ci", "ci", []string{ScopeTodosRead}, &expire, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	r := ts.do(t, "POST", "/api/admin/users/"+strconv.FormatUint(u.ID, 10)+"/impersonate", adminToken, map[string]string{})
+	var imp impersonationResponse
+	if err := json.Unmarshal(r.body, &imp); err != nil || r.status != 201 {
+		t.Fatalf("impersonate = %d %s", r.status, r.body)
+	}
+
+	// The admin commands build a server that was never set up.
+	cli := &Server{
+		Tokens:         ts.Tokens,
+		PersonalTokens: ts.PersonalTokens,
+		Impersonations: ts.Impersonations,
+		AuthEvents:     ts.AuthEvents,
+		Users:          ts.Users,
+	}
+	n, err := cli.LogoutEverywhere(u)
+	if err != nil || n != 3 {
+		t.Errorf("LogoutEverywhere = %d, %v, want 3, nil", n, err)
+	}
+
+	for name, token := range map[string]string{"session": token, "personal token": personalTokenPrefix + "ci", "impersonation": imp.Token} {
+		if r := ts.do(t, "GET", "/api/auth", token, nil); r.status != 401 {
+			t.Errorf("%s after LogoutEverywhere = %d %s, want 401", name, r.status, r.body)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/fasthttp/router"
+	"github.com/iwajezhgf/todo-backend/hasher"
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/iwajezhgf/todo-backend/passwords"
 	"github.com/iwajezhgf/todo-backend/storage"
 	"github.com/valyala/fasthttp"
 )
@@ -11,32 +16,122 @@ import (
 type Server struct {
 	s *fasthttp.Server
 
-	Todos  *storage.TodoStorage
-	Tokens *storage.TokenStorage
-	Users  *storage.UserStorage
+	Todos          storage.TodoStore
+	Tokens         storage.TokenStore
+	PersonalTokens storage.PersonalTokenStore
+	TwoFactor      storage.TwoFactorStore
+	Attempts       storage.AttemptStore
+	PasswordResets storage.PasswordResetStore
+	EmailChanges   storage.EmailChangeStore
+	Impersonations storage.ImpersonationStore
+	AuthEvents     storage.AuthEventStore
+	Users          storage.UserStore
+
+	// Hasher hashes new passwords and checks them against stored hashes.
+	Hasher *hasher.Hasher
+	Mailer mail.Mailer
+	// PublicURL is the address of the web app that links in emails point to.
+	PublicURL string
+
+	Auth AuthConfig
+
+	jwt       *jwtIssuer
+	denylist  *denylist
+	verifyKey []byte
 }
 
-func (s *Server) Run(host string) error {
-	r := router.New()
+// AuthConfig controls how long session tokens stay valid.
+type AuthConfig struct {
+	// TokenLifetime is how long a token is valid after login, or after its
+	// last use when Sliding is enabled.
+	TokenLifetime time.Duration
+	Sliding       bool
+	// RenewInterval limits how often a token's last use and expiry are written.
+	RenewInterval time.Duration
+	// AbsoluteLifetime caps a session's lifetime since login. Zero disables it.
+	AbsoluteLifetime time.Duration
+	// IdleTimeout ends a session that has not been used for this long. Zero disables it.
+	IdleTimeout time.Duration
+	// AccessTokenLifetime enables refresh tokens when set. Login then returns an
+	// access token valid for this long and a refresh token that renews it for
+	// the lifetime of the session.
+	AccessTokenLifetime time.Duration
 
-	api := r.Group("/api")
-	{
-		api.POST("/register", s.validateFields(authUser{})(s.handleRegister))
-		api.POST("/login", s.validateFields(authUser{})(s.handleLogin))
-		api.GET("/auth", s.onlyAuthorized(s.handleAuth))
-		api.POST("/logout", s.onlyAuthorized(s.handleLogout))
+	// Mode is AuthModeOpaque (the default) or AuthModeJWT.
+	Mode string
+	JWT  JWTConfig
+
+	// TOTPIssuer names the service in authenticator apps.
+	TOTPIssuer string
+	// ChallengeLifetime is how long the second login step may take for users
+	// with two-factor authentication.
+	ChallengeLifetime time.Duration
+
+	Lockout LockoutConfig
+
+	// PasswordResetLifetime is how long an emailed password reset link works.
+	PasswordResetLifetime time.Duration
 
-		api.POST("/settings/password", s.onlyAuthorized(s.validateFields(settingsPassword{})(s.ChangePassword)))
+	Verification VerificationConfig
 
-		api.POST("/todo", s.onlyAuthorized(s.validateFields(createTodo{})(s.handleCreateTodo)))
-		api.POST("/todo/{id}", s.onlyAuthorized(s.handleCompleteTodo))
-		api.GET("/todo", s.onlyAuthorized(s.handleGetTodos))
-		api.PUT("/todo", s.onlyAuthorized(s.validateFields(editTodo{})(s.handleEditTodo)))
-		api.DELETE("/todo/{id}", s.onlyAuthorized(s.handleDeleteTodo))
+	// EmailConfirmLifetime is how long the link sent to a new email address
+	// works, EmailRevertLifetime how long the old address can undo the change.
+	EmailConfirmLifetime time.Duration
+	EmailRevertLifetime  time.Duration
+
+	// DeletionGracePeriod is how long a deleted account can be restored.
+	// Zero deletes accounts right away.
+	DeletionGracePeriod time.Duration
+
+	// ImpersonationLifetime is how long an impersonation token works.
+	ImpersonationLifetime time.Duration
+
+	// PasswordPolicy is checked whenever a password is set.
+	PasswordPolicy passwords.Policy
+}
+
+// tokenExpire returns the expiry of a token created at created and last used
+// at lastUsed, so that every lifetime rule is enforced by the expire column.
+func (c AuthConfig) tokenExpire(created, lastUsed time.Time) time.Time {
+	expire := created.Add(c.TokenLifetime)
+	if c.Sliding {
+		expire = lastUsed.Add(c.TokenLifetime)
+	}
+	if c.IdleTimeout > 0 {
+		if idle := lastUsed.Add(c.IdleTimeout); idle.Before(expire) {
+			expire = idle
+		}
+	}
+	if c.AbsoluteLifetime > 0 {
+		if absolute := created.Add(c.AbsoluteLifetime); absolute.Before(expire) {
+			expire = absolute
+		}
+	}
+
+	return expire
+}
+
+// accessExpire returns the expiry of an access token issued at now for a
+// session that ends at sessionExpire.
+func (c AuthConfig) accessExpire(now, sessionExpire time.Time) time.Time {
+	expire := now.Add(c.AccessTokenLifetime)
+	if sessionExpire.Before(expire) {
+		return sessionExpire
+	}
+
+	return expire
+}
+
+func (s *Server) Run(host string) error {
+	if err := s.setup(); err != nil {
+		return err
+	}
+	if s.jwt != nil {
+		go s.startDenylistSync()
 	}
 
 	srv := &fasthttp.Server{
-		Handler:           r.Handler,
+		Handler:           s.handler(),
 		ReadTimeout:       60 * time.Second,
 		WriteTimeout:      60 * time.Second,
 		ReduceMemoryUsage: true,
@@ -44,3 +139,112 @@ func (s *Server) Run(host string) error {
 
 	return srv.ListenAndServe(host)
 }
+
+// setup checks the configuration and prepares the signing keys.
+func (s *Server) setup() error {
+	if err := s.setupAuthMode(); err != nil {
+		return err
+	}
+	if s.jwt != nil {
+		s.syncDenylist()
+	}
+
+	switch s.Auth.Verification.UnverifiedAccess {
+	case UnverifiedFull, UnverifiedReadOnly, "":
+	default:
+		return fmt.Errorf("unsupported unverified access %q", s.Auth.Verification.UnverifiedAccess)
+	}
+
+	if s.Hasher == nil {
+		return errors.New("no password hasher configured")
+	}
+
+	var err error
+	s.verifyKey, err = newVerificationKey(s.Auth.Verification.Secret)
+	return err
+}
+
+// setupAuthMode prepares signing and denying JWTs when the jwt auth mode is on.
+func (s *Server) setupAuthMode() error {
+	switch s.Auth.Mode {
+	case AuthModeOpaque, "":
+	case AuthModeJWT:
+		var err error
+		s.jwt, err = newJWTIssuer(s.Auth.JWT)
+		if err != nil {
+			return err
+		}
+
+		s.denylist = newDenylist()
+	default:
+		return fmt.Errorf("unsupported auth mode %q", s.Auth.Mode)
+	}
+
+	return nil
+}
+
+func (s *Server) handler() fasthttp.RequestHandler {
+	r := router.New()
+
+	api := r.Group("/api")
+	{
+		api.POST("/register", s.validateFields(authUser{})(s.handleRegister))
+		api.POST("/login", s.validateFields(authUser{})(s.handleLogin))
+		api.POST("/login/2fa", s.validateFields(loginTwoFactor{})(s.handleLoginTwoFactor))
+		api.POST("/password/forgot", s.validateFields(forgotPassword{})(s.handleForgotPassword))
+		api.POST("/password/reset", s.validateFields(resetPassword{})(s.handleResetPassword))
+		api.POST("/verify", s.validateFields(verifyEmail{})(s.handleVerify))
+		api.POST("/verify/resend", s.onlyAuthorized(scopeSession)(s.handleResendVerification))
+		api.GET("/auth", s.onlyAuthorized(ScopeAccount)(s.handleAuth))
+		api.POST("/impersonation/stop", s.onlyAuthorized(scopeImpersonation)(s.handleStopImpersonation))
+		api.POST("/logout", s.onlyAuthorized(scopeSession)(s.handleLogout))
+		api.POST("/token/refresh", s.validateFields(refreshRequest{})(s.handleRefreshToken))
+
+		api.GET("/profile", s.onlyAuthorized(ScopeAccount)(s.handleGetProfile))
+		api.PATCH("/profile", s.onlyAuthorized(ScopeAccount)(s.onlyVerified(s.handleEditProfile)))
+
+		api.POST("/settings/password", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.validateFields(settingsPassword{})(s.ChangePassword))))
+		api.POST("/settings/email", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.validateFields(changeEmail{})(s.handleChangeEmail))))
+		api.POST("/settings/email/confirm", s.validateFields(emailChangeToken{})(s.handleConfirmEmail))
+		api.POST("/settings/email/revert", s.validateFields(emailChangeToken{})(s.handleRevertEmail))
+
+		api.DELETE("/account", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.validateFields(deleteAccount{})(s.handleDeleteAccount))))
+		api.POST("/account/restore", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.handleRestoreAccount)))
+		api.GET("/account/export", s.onlyAuthorized(scopeSession)(s.handleExportAccount))
+		api.GET("/account/security-log", s.onlyAuthorized(ScopeAccount)(s.handleGetSecurityLog))
+
+		api.GET("/sessions", s.onlyAuthorized(scopeSession)(s.handleGetSessions))
+		api.PUT("/sessions/{id}", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.validateFields(renameSession{})(s.handleRenameSession))))
+		api.DELETE("/sessions/{id}", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.handleDeleteSession)))
+		api.POST("/sessions/revoke-others", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.handleRevokeOtherSessions)))
+
+		api.GET("/2fa", s.onlyAuthorized(ScopeAccount)(s.handleGetTwoFactor))
+		api.POST("/2fa/enroll", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.handleEnrollTwoFactor)))
+		api.POST("/2fa/confirm", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.validateFields(confirmTwoFactor{})(s.handleConfirmTwoFactor))))
+		api.POST("/2fa/disable", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.validateFields(disableTwoFactor{})(s.handleDisableTwoFactor))))
+
+		api.POST("/tokens", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.validateFields(createPersonalToken{})(s.handleCreatePersonalToken))))
+		api.GET("/tokens", s.onlyAuthorized(scopeSession)(s.handleGetPersonalTokens))
+		api.DELETE("/tokens/{id}", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.handleDeletePersonalToken)))
+
+		admin := api.Group("/admin")
+		admin.GET("/users", s.onlyAuthorized(scopeSession)(s.onlyPermitted(PermUsersRead)(s.handleAdminListUsers)))
+		admin.GET("/users/{id}", s.onlyAuthorized(scopeSession)(s.onlyPermitted(PermUsersRead)(s.handleAdminGetUser)))
+		admin.POST("/users/{id}/disable", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.onlyPermitted(PermUsersWrite)(s.handleAdminDisableUser))))
+		admin.POST("/users/{id}/enable", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.onlyPermitted(PermUsersWrite)(s.handleAdminEnableUser))))
+		admin.POST("/users/{id}/logout", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.onlyPermitted(PermSessionsRevoke)(s.handleAdminLogoutUser))))
+		admin.POST("/users/{id}/impersonate", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.onlyPermitted(PermImpersonate)(s.handleStartImpersonation))))
+		admin.POST("/impersonations/{id}/stop", s.onlyAuthorized(scopeSession)(s.onlyVerified(s.onlyPermitted(PermImpersonate)(s.handleAdminStopImpersonation))))
+		admin.GET("/impersonations/{id}/audit", s.onlyAuthorized(scopeSession)(s.onlyPermitted(PermUsersRead)(s.handleGetImpersonationAudit)))
+		admin.GET("/auth-events", s.onlyAuthorized(scopeSession)(s.onlyPermitted(PermAuthEventsRead)(s.handleAdminAuthEvents)))
+		admin.GET("/usage", s.onlyAuthorized(scopeSession)(s.onlyPermitted(PermUsageRead)(s.handleAdminUsage)))
+
+		api.POST("/todo", s.onlyAuthorized(ScopeTodosWrite)(s.onlyVerified(s.validateFields(createTodo{})(s.handleCreateTodo))))
+		api.POST("/todo/{id}", s.onlyAuthorized(ScopeTodosWrite)(s.onlyVerified(s.handleCompleteTodo)))
+		api.GET("/todo", s.onlyAuthorized(ScopeTodosRead)(s.handleGetTodos))
+		api.PUT("/todo", s.onlyAuthorized(ScopeTodosWrite)(s.onlyVerified(s.validateFields(editTodo{})(s.handleEditTodo))))
+		api.DELETE("/todo/{id}", s.onlyAuthorized(ScopeTodosWrite)(s.onlyVerified(s.handleDeleteTodo)))
+	}
+
+	return r.Handler
+}
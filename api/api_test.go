@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/hasher"
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/iwajezhgf/todo-backend/storage/memory"
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "Tr0ub4dor&3x"
+
+// testServer serves the routes of a Server on in-memory stores without
+// listening on a port.
+type testServer struct {
+	*Server
+	handler fasthttp.RequestHandler
+}
+
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mail.Message
+}
+
+func (m *testMailer) Send(msg mail.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// newTestServer returns a server with the defaults of config.yml, changed by
+// configure when it is not nil.
+func newTestServer(t *testing.T, configure func(s *Server)) *testServer {
+	t.Helper()
+
+	h, err := hasher.New(hasher.Config{Algorithm: hasher.Bcrypt, BcryptCost: bcrypt.MinCost})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mem := memory.NewStorage()
+	s := &Server{
+		Todos:          &memory.TodoStorage{Storage: mem},
+		Tokens:         &memory.TokenStorage{Storage: mem},
+		PersonalTokens: &memory.PersonalTokenStorage{Storage: mem},
+		TwoFactor:      &memory.TwoFactorStorage{Storage: mem},
+		Attempts:       &memory.AttemptStorage{Storage: mem},
+		PasswordResets: &memory.PasswordResetStorage{Storage: mem},
+		EmailChanges:   &memory.EmailChangeStorage{Storage: mem},
+		Impersonations: &memory.ImpersonationStorage{Storage: mem},
+		AuthEvents:     &memory.AuthEventStorage{Storage: mem},
+		Users:          &memory.UserStorage{Storage: mem},
+
+		Hasher:    h,
+		Mailer:    &testMailer{},
+		PublicURL: "https://todo.example.com",
+
+		Auth: AuthConfig{
+			TokenLifetime:     time.Hour,
+			RenewInterval:     time.Minute,
+			TOTPIssuer:        "todo-backend",
+			ChallengeLifetime: 5 * time.Minute,
+			Lockout: LockoutConfig{
+				AccountThreshold:    5,
+				IPThreshold:         50,
+				ResetEmailThreshold: 3,
+				ResetIPThreshold:    20,
+				ResendUserThreshold: 3,
+				ResendIPThreshold:   20,
+				BaseDelay:           30 * time.Second,
+				MaxDelay:            15 * time.Minute,
+				Window:              time.Hour,
+			},
+			PasswordResetLifetime: time.Hour,
+			Verification: VerificationConfig{
+				Secret:           base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), 32)),
+				Lifetime:         48 * time.Hour,
+				UnverifiedAccess: UnverifiedFull,
+			},
+			EmailConfirmLifetime:  24 * time.Hour,
+			EmailRevertLifetime:   7 * 24 * time.Hour,
+			ImpersonationLifetime: 30 * time.Minute,
+		},
+	}
+	if configure != nil {
+		configure(s)
+	}
+	if err = s.setup(); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testServer{Server: s, handler: s.handler()}
+}
+
+// createUser adds a user with testPassword and returns them with the token of
+// a new session.
+func (ts *testServer) createUser(t *testing.T, email, role string, verified bool) (*types.User, string) {
+	t.Helper()
+
+	hash, err := ts.Hasher.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Users.Create(email, hash); err != nil {
+		t.Fatal(err)
+	}
+	u, err := ts.Users.GetByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified {
+		if err = ts.Users.Verify(u.ID, time.Now().UTC()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if role != "" {
+		if err = ts.Users.SetRole(u.ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	u, err = ts.Users.GetById(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u, ts.newSession(t, u.ID)
+}
+
+// newSession returns the token of a new session of the user.
+func (ts *testServer) newSession(t *testing.T, userId uint64) string {
+	t.Helper()
+
+	token, err := generateRandomToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Tokens.Create(token, userId, time.Now().UTC().Add(time.Hour), "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	return token
+}
+
+type testResponse struct {
+	status int
+	body   json.RawMessage
+	// code is the error code of an error response.
+	code string
+}
+
+// do sends a request with the bearer token and body, which is encoded as
+// JSON unless it is a string.
+func (ts *testServer) do(t *testing.T, method, path, token string, body interface{}) testResponse {
+	t.Helper()
+
+	var req fasthttp.Request
+	req.Header.SetMethod(method)
+	req.SetRequestURI(path)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	switch b := body.(type) {
+	case nil:
+	case string:
+		req.SetBodyString(b)
+	default:
+		encoded, err := json.Marshal(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBody(encoded)
+	}
+
+	var ctx fasthttp.RequestCtx
+	ctx.Init(&req, &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1234}, nil)
+	ts.handler(&ctx)
+
+	var envelope struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(ctx.Response.Body(), &envelope); err != nil {
+		t.Fatalf("%s %s: %v in %q", method, path, err, ctx.Response.Body())
+	}
+	r := testResponse{status: ctx.Response.StatusCode(), body: envelope.Response}
+	if r.status >= 400 {
+		var e struct {
+			Code string `json:"code"`
+		}
+		_ = json.Unmarshal(r.body, &e)
+		r.code = e.Code
+	}
+
+	return r
+}
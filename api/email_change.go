@@ -0,0 +1,199 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+type changeEmail struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+func (s *Server) handleChangeEmail(ctx *fasthttp.RequestCtx) {
+	var ce changeEmail
+	json.Unmarshal(ctx.PostBody(), &ce)
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	keys := s.attemptKeys(ctx, u.Email)
+	if !s.checkLockout(ctx, keys) {
+		return
+	}
+
+	if !s.checkPassword(ce.Password, u.Password) {
+		s.failAttempt(keys)
+		s.recordEvent(ctx, u.ID, u.Email, types.EventEmailChange, InvalidCredentials)
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCredentials)
+		return
+	}
+
+	if !validEmail(ce.Email) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidEmail)
+		return
+	}
+
+	if strings.EqualFold(ce.Email, u.Email) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", EmailEquals)
+		return
+	}
+
+	_, err = s.Users.GetByEmail(ce.Email)
+	if err == nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", AlreadyExists)
+		return
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	expire := time.Now().UTC().Add(s.Auth.EmailConfirmLifetime)
+	err = s.EmailChanges.Create(token, types.EmailChangeConfirm, u.ID, u.Email, ce.Email, expire)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	link := s.PublicURL + "/confirm-email?token=" + url.QueryEscape(token)
+	go s.sendMail(mail.Message{
+		To:      ce.Email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf(
+			"To use this address for your account instead of %s, open\n\n%s\n\n"+
+				"The link is valid for %.0f hours. If you did not ask for this, ignore this email.",
+			u.Email, link, s.Auth.EmailConfirmLifetime.Hours(),
+		),
+	})
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+type emailChangeToken struct {
+	Token string `json:"token"`
+}
+
+// useEmailChange returns the unexpired, unused token of kind and marks it used.
+// The user must still have the address the token was issued for.
+func (s *Server) useEmailChange(ctx *fasthttp.RequestCtx, kind string) (*types.EmailChange, *types.User, bool) {
+	var et emailChangeToken
+	json.Unmarshal(ctx.PostBody(), &et)
+
+	c, err := s.EmailChanges.GetByToken(et.Token)
+	if err != nil || c.Kind != kind || c.Used || !time.Now().UTC().Before(c.Expire) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return nil, nil, false
+	}
+
+	current := c.OldEmail
+	if kind == types.EmailChangeRevert {
+		current = c.NewEmail
+	}
+
+	u, err := s.Users.GetById(c.UserID)
+	if err != nil || !strings.EqualFold(u.Email, current) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return nil, nil, false
+	}
+
+	used, err := s.EmailChanges.Use(c.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return nil, nil, false
+	}
+	if !used {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return nil, nil, false
+	}
+
+	return c, u, true
+}
+
+func (s *Server) handleConfirmEmail(ctx *fasthttp.RequestCtx) {
+	c, u, ok := s.useEmailChange(ctx, types.EmailChangeConfirm)
+	if !ok {
+		return
+	}
+
+	// The unique email column settles concurrent changes to the same address.
+	err := s.Users.EditEmail(u.ID, c.NewEmail)
+	if errors.Is(err, storage.ErrDuplicate) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", AlreadyExists)
+		return
+	}
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	expire := time.Now().UTC().Add(s.Auth.EmailRevertLifetime)
+	err = s.EmailChanges.Create(token, types.EmailChangeRevert, u.ID, c.OldEmail, c.NewEmail, expire)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	s.recordEvent(ctx, u.ID, c.NewEmail, types.EventEmailChange, "")
+
+	link := s.PublicURL + "/revert-email?token=" + url.QueryEscape(token)
+	go s.sendMail(mail.Message{
+		To:      c.OldEmail,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf(
+			"The email address of your account was changed to %s.\n\n"+
+				"If you did not do this, open the following link within %.0f days to restore this "+
+				"address and log out every session:\n\n%s",
+			c.NewEmail, s.Auth.EmailRevertLifetime.Hours()/24, link,
+		),
+	})
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+func (s *Server) handleRevertEmail(ctx *fasthttp.RequestCtx) {
+	c, u, ok := s.useEmailChange(ctx, types.EmailChangeRevert)
+	if !ok {
+		return
+	}
+
+	err := s.Users.EditEmail(u.ID, c.OldEmail)
+	if errors.Is(err, storage.ErrDuplicate) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", AlreadyExists)
+		return
+	}
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	// Whoever changed the address is logged out; no session has ID 0.
+	_, err = s.revokeOtherSessions(u.ID, 0)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.recordEvent(ctx, u.ID, c.OldEmail, types.EventEmailChange, "")
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+// impersonationPrefix tells impersonation tokens apart from other tokens.
+const impersonationPrefix = "imp_"
+
+// impersonationScopes are the routes an impersonation token reaches. Routes
+// that need a login session, such as changing the password or email
+// address, stay out of reach, and account routes are read-only.
+var impersonationScopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeAccount, scopeImpersonation}
+
+// scopeImpersonation marks the route that ends an impersonation. Only
+// impersonation tokens have it.
+const scopeImpersonation = "impersonation"
+
+func isImpersonationToken(token string) bool {
+	return strings.HasPrefix(token, impersonationPrefix)
+}
+
+type startImpersonation struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type impersonationResponse struct {
+	types.Impersonation
+	Token string `json:"token"`
+}
+
+func (s *Server) handleStartImpersonation(ctx *fasthttp.RequestCtx) {
+	var si startImpersonation
+	json.Unmarshal(ctx.PostBody(), &si)
+
+	if len(si.Reason) > 255 {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid reason", "")
+		return
+	}
+
+	target, ok := s.adminTarget(ctx)
+	if !ok {
+		return
+	}
+
+	admin, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+	// Acting as another admin or support user would hand out their permissions.
+	if target.ID == admin.ID || target.Role != types.RoleUser {
+		errorResponse(ctx, fasthttp.StatusForbidden, "Only regular users can be impersonated", Forbidden)
+		return
+	}
+	if target.DisabledAt != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Account is disabled", AccountDisabled)
+		return
+	}
+
+	randomToken, err := generateRandomToken()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	token := impersonationPrefix + randomToken
+
+	expire := time.Now().UTC().Add(s.Auth.ImpersonationLifetime)
+	err = s.Impersonations.Create(token, admin.ID, target.ID, si.Reason, expire)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	imp, err := s.Impersonations.GetByToken(token)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.recordImpersonation(imp, admin.ID, types.AuditStart, nil)
+
+	okResponse(ctx, fasthttp.StatusCreated, impersonationResponse{Impersonation: *imp, Token: token})
+}
+
+// handleStopImpersonation ends the impersonation whose token made the request.
+func (s *Server) handleStopImpersonation(ctx *fasthttp.RequestCtx) {
+	imp, ok := ctx.UserValue("impersonation").(*types.Impersonation)
+	if !ok {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Not an impersonation token", "")
+		return
+	}
+
+	s.stopImpersonation(ctx, imp, imp.AdminID)
+}
+
+// handleAdminStopImpersonation lets an admin end any impersonation.
+func (s *Server) handleAdminStopImpersonation(ctx *fasthttp.RequestCtx) {
+	imp, ok := s.impersonationTarget(ctx)
+	if !ok {
+		return
+	}
+
+	admin, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+	// Ending someone else's impersonation acts on their session, so it needs
+	// the same rank as logging them out.
+	if imp.AdminID != admin.ID {
+		if owner, err := s.Users.GetById(imp.AdminID); err == nil && !canManage(admin, owner) {
+			errorResponse(ctx, fasthttp.StatusForbidden, "Forbidden", Forbidden)
+			return
+		}
+	}
+
+	s.stopImpersonation(ctx, imp, admin.ID)
+}
+
+func (s *Server) stopImpersonation(ctx *fasthttp.RequestCtx, imp *types.Impersonation, adminId uint64) {
+	now := time.Now().UTC()
+	ended, err := s.Impersonations.End(imp.ID, now)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if ended {
+		imp.Ended = &now
+		s.recordImpersonation(imp, adminId, types.AuditStop, nil)
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, imp)
+}
+
+func (s *Server) handleGetImpersonationAudit(ctx *fasthttp.RequestCtx) {
+	imp, ok := s.impersonationTarget(ctx)
+	if !ok {
+		return
+	}
+
+	entries, err := s.Impersonations.GetAudit(imp.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, struct {
+		Impersonation types.Impersonation        `json:"impersonation"`
+		Audit         []types.ImpersonationAudit `json:"audit"`
+	}{*imp, entries})
+}
+
+// impersonationTarget loads the impersonation named by the id route
+// parameter, or responds with an error and returns false.
+func (s *Server) impersonationTarget(ctx *fasthttp.RequestCtx) (*types.Impersonation, bool) {
+	id, err := strconv.ParseUint(ctx.UserValue("id").(string), 10, 64)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid ID", "")
+		return nil, false
+	}
+
+	imp, err := s.Impersonations.GetById(id)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusNotFound, "", NotFound)
+		return nil, false
+	}
+
+	return imp, true
+}
+
+// authorizeImpersonation checks the impersonation of a token and lets the request
+// act as the impersonated user. The admin behind it must still be allowed
+// to impersonate. Refused requests are audited too.
+func (s *Server) authorizeImpersonation(ctx *fasthttp.RequestCtx, imp *types.Impersonation, scope string) bool {
+	refuse := func(status int, message, code string) bool {
+		errorResponse(ctx, status, message, code)
+		s.recordImpersonation(imp, imp.AdminID, types.AuditRequest, ctx)
+		return false
+	}
+
+	if imp.Ended != nil || !time.Now().UTC().Before(imp.Expire) {
+		return refuse(fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+	}
+
+	admin, err := s.activeUser(imp.AdminID)
+	if err != nil || !hasScope(rolePermissions[admin.Role], PermImpersonate) {
+		return refuse(fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+	}
+
+	// The account can be looked at but not changed, so an impersonator
+	// cannot revoke the user's sessions or edit their profile.
+	if !hasScope(impersonationScopes, scope) || (scope == ScopeAccount && !ctx.IsGet()) {
+		return refuse(fasthttp.StatusForbidden, "Not allowed while impersonating a user", InsufficientScope)
+	}
+
+	ctx.SetUserValue("user_id", imp.UserID)
+	ctx.SetUserValue("impersonation", imp)
+	return true
+}
+
+// recordImpersonation adds an entry to the audit trail of imp. A failure is
+// logged rather than failing a request that already happened.
+func (s *Server) recordImpersonation(imp *types.Impersonation, adminId uint64, action string, ctx *fasthttp.RequestCtx) {
+	e := types.ImpersonationAudit{
+		ImpersonationID: imp.ID,
+		AdminID:         adminId,
+		UserID:          imp.UserID,
+		Action:          action,
+		Created:         time.Now().UTC(),
+	}
+	if ctx != nil {
+		e.Method = string(ctx.Method())
+		e.Path = string(ctx.Path())
+		if len(e.Path) > 1024 {
+			e.Path = e.Path[:1024]
+		}
+		e.Status = ctx.Response.StatusCode()
+	}
+
+	if err := s.Impersonations.Record(e); err != nil {
+		log.Println("audit error: ", err)
+	}
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+const (
+	AuthModeOpaque = "opaque"
+	AuthModeJWT    = "jwt"
+)
+
+// JWTConfig configures signed access tokens for the jwt auth mode.
+type JWTConfig struct {
+	// Algorithm is EdDSA or HS256.
+	Algorithm string
+	Issuer    string
+	// ActiveKID selects the key new tokens are signed with. The other keys are
+	// only used to verify tokens issued before a rotation.
+	ActiveKID string
+	Keys      []JWTKey
+}
+
+// JWTKey is a base64 encoded HS256 secret or Ed25519 seed.
+type JWTKey struct {
+	KID string
+	Key string
+}
+
+type jwtIssuer struct {
+	method     jwt.SigningMethod
+	issuer     string
+	activeKID  string
+	signKeys   map[string]interface{}
+	verifyKeys map[string]interface{}
+}
+
+func newJWTIssuer(c JWTConfig) (*jwtIssuer, error) {
+	j := &jwtIssuer{
+		issuer:     c.Issuer,
+		activeKID:  c.ActiveKID,
+		signKeys:   make(map[string]interface{}),
+		verifyKeys: make(map[string]interface{}),
+	}
+
+	switch c.Algorithm {
+	case "EdDSA":
+		j.method = jwt.SigningMethodEdDSA
+	case "HS256":
+		j.method = jwt.SigningMethodHS256
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", c.Algorithm)
+	}
+
+	for _, k := range c.Keys {
+		raw, err := base64.StdEncoding.DecodeString(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", k.KID, err)
+		}
+
+		if j.method == jwt.SigningMethodEdDSA {
+			if len(raw) != ed25519.SeedSize {
+				return nil, fmt.Errorf("jwt key %q: an Ed25519 seed must be %d bytes", k.KID, ed25519.SeedSize)
+			}
+			private := ed25519.NewKeyFromSeed(raw)
+			j.signKeys[k.KID] = private
+			j.verifyKeys[k.KID] = private.Public()
+		} else {
+			if len(raw) < 32 {
+				return nil, fmt.Errorf("jwt key %q: an HS256 secret must be at least 32 bytes", k.KID)
+			}
+			j.signKeys[k.KID] = raw
+			j.verifyKeys[k.KID] = raw
+		}
+	}
+
+	if _, ok := j.signKeys[c.ActiveKID]; !ok {
+		return nil, fmt.Errorf("jwt active key %q is not in the key set", c.ActiveKID)
+	}
+
+	return j, nil
+}
+
+// sign returns a token for the user that expires at expire. jti identifies the
+// session the token belongs to in the tokens table.
+func (j *jwtIssuer) sign(userId uint64, jti string, expire time.Time) (string, error) {
+	now := time.Now()
+	t := jwt.NewWithClaims(j.method, jwt.RegisteredClaims{
+		Issuer:    j.issuer,
+		Subject:   strconv.FormatUint(userId, 10),
+		ID:        jti,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expire),
+	})
+	t.Header["kid"] = j.activeKID
+
+	return t.SignedString(j.signKeys[j.activeKID])
+}
+
+// parse verifies the signature and expiry of token and returns its user id,
+// jti and expiry.
+func (j *jwtIssuer) parse(token string) (uint64, string, time.Time, error) {
+	var claims jwt.RegisteredClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		key, ok := j.verifyKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{j.method.Alg()}),
+		jwt.WithIssuer(j.issuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return 0, "", time.Time{}, err
+	}
+
+	userId, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil || claims.ID == "" {
+		return 0, "", time.Time{}, errors.New("invalid token claims")
+	}
+
+	return userId, claims.ID, claims.ExpiresAt.Time, nil
+}
+
+// denylist holds the digests of revoked JWTs until they expire. It is shared
+// between instances through the token_denylist table.
+type denylist struct {
+	mu      sync.RWMutex
+	entries map[string]time.Time
+}
+
+func newDenylist() *denylist {
+	return &denylist{entries: make(map[string]time.Time)}
+}
+
+func (d *denylist) has(tokenHash string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, ok := d.entries[tokenHash]
+	return ok
+}
+
+func (d *denylist) add(tokenHash string, expire time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[tokenHash] = expire
+}
+
+// merge adds entries loaded from the database and drops expired ones.
+func (d *denylist) merge(entries map[string]time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for hash, expire := range entries {
+		d.entries[hash] = expire
+	}
+
+	now := time.Now()
+	for hash, expire := range d.entries {
+		if now.After(expire) {
+			delete(d.entries, hash)
+		}
+	}
+}
+
+func (s *Server) startDenylistSync() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.syncDenylist()
+		}
+	}
+}
+
+func (s *Server) syncDenylist() {
+	entries, err := s.Tokens.GetDenied()
+	if err != nil {
+		log.Println("failed to load token denylist: ", err)
+		return
+	}
+
+	s.denylist.merge(entries)
+}
+
+// denyTokens stops already issued JWTs of the given sessions from being
+// accepted. Opaque tokens stop working once their row is deleted, so there is
+// nothing to do in the default mode.
+func (s *Server) denyTokens(tokens ...types.Token) {
+	if s.jwt == nil {
+		return
+	}
+
+	for _, t := range tokens {
+		s.denylist.add(t.TokenHash, t.Expire)
+		_ = s.Tokens.Deny(t.TokenHash, t.Expire)
+	}
+}
+
+// issueAccessToken returns the bearer token handed to the client and the key
+// its session is stored under. Both are the same opaque token unless the jwt
+// auth mode is on, where the key is the jti of the signed token.
+func (s *Server) issueAccessToken(userId uint64, expire time.Time) (bearer, key string, err error) {
+	key, err = generateRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	if s.jwt == nil {
+		return key, key, nil
+	}
+
+	bearer, err = s.jwt.sign(userId, key, expire)
+	return bearer, key, err
+}
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/iwajezhgf/todo-backend/storage"
+)
+
+func testJWTKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func newTestIssuer(t *testing.T, algorithm, activeKID string, kids ...string) *jwtIssuer {
+	t.Helper()
+
+	c := JWTConfig{Algorithm: algorithm, Issuer: "todo-backend", ActiveKID: activeKID}
+	for i, kid := range kids {
+		c.Keys = append(c.Keys, JWTKey{KID: kid, Key: testJWTKey(byte('a' + i))})
+	}
+	j, err := newJWTIssuer(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return j
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{"EdDSA", "HS256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			j := newTestIssuer(t, algorithm, "k1", "k1")
+			expire := time.Now().Add(time.Hour).Truncate(time.Second)
+
+			token, err := j.sign(42, "session", expire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			userId, jti, gotExpire, err := j.parse(token)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if userId != 42 || jti != "session" || !gotExpire.Equal(expire) {
+				t.Errorf("parse = %d, %q, %s, want 42, \"session\", %s", userId, jti, gotExpire, expire)
+			}
+		})
+	}
+}
+
+func TestJWTRejected(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	edKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{'a'}, 32))
+
+	// forge signs claims that would be valid for the EdDSA issuer of k1.
+	forge := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.RegisteredClaims) string {
+		tok := jwt.NewWithClaims(method, claims)
+		tok.Header["kid"] = kid
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := jwt.RegisteredClaims{
+		Issuer:    "todo-backend",
+		Subject:   "42",
+		ID:        "session",
+		ExpiresAt: jwt.NewNumericDate(expire),
+	}
+	withClaims := func(change func(c *jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		c := valid
+		change(&c)
+		return c
+	}
+
+	j := newTestIssuer(t, "EdDSA", "k1", "k1")
+	other := newTestIssuer(t, "EdDSA", "k2", "k1", "k2")
+	otherToken, err := other.sign(42, "session", expire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"valid control", ""},
+		{"unknown kid", otherToken},
+		{"expired", forge(jwt.SigningMethodEdDSA, "k1", edKey, withClaims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}))},
+		{"no expiry", forge(jwt.SigningMethodEdDSA, "k1", edKey, withClaims(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		}))},
+		{"other issuer", forge(jwt.SigningMethodEdDSA, "k1", edKey, withClaims(func(c *jwt.RegisteredClaims) {
+			c.Issuer = "someone-else"
+		}))},
+		{"no jti", forge(jwt.SigningMethodEdDSA, "k1", edKey, withClaims(func(c *jwt.RegisteredClaims) {
+			c.ID = ""
+		}))},
+		{"bad subject", forge(jwt.SigningMethodEdDSA, "k1", edKey, withClaims(func(c *jwt.RegisteredClaims) {
+			c.Subject = "admin"
+		}))},
+		// The public key is no secret, so an HS256 token signed with it must
+		// not pass as EdDSA.
+		{"HS256 with the public key", forge(jwt.SigningMethodHS256, "k1", []byte(edKey.Public().(ed25519.PublicKey)), valid)},
+		{"alg none", forge(jwt.SigningMethodNone, "k1", jwt.UnsafeAllowNoneSignatureType, valid)},
+		{"tampered", forge(jwt.SigningMethodEdDSA, "k1", edKey, valid) + "x"},
+		{"garbage", "not.a.jwt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.token == "" {
+				if _, _, _, err := j.parse(forge(jwt.SigningMethodEdDSA, "k1", edKey, valid)); err != nil {
+					t.Fatalf("parse of a valid forged token = %v, the cases below prove nothing", err)
+				}
+				return
+			}
+			if userId, _, _, err := j.parse(tt.token); err == nil {
+				t.Errorf("parse = %d, want an error", userId)
+			}
+		})
+	}
+}
+
+func TestJWTRotation(t *testing.T) {
+	expire := time.Now().Add(time.Hour)
+	before := newTestIssuer(t, "EdDSA", "k1", "k1")
+	during := newTestIssuer(t, "EdDSA", "k2", "k1", "k2")
+	after, err := newJWTIssuer(JWTConfig{
+		Algorithm: "EdDSA", Issuer: "todo-backend", ActiveKID: "k2",
+		Keys: []JWTKey{{KID: "k2", Key: testJWTKey('b')}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, err := before.sign(1, "old", expire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := during.sign(1, "new", expire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, err = during.parse(old); err != nil {
+		t.Errorf("token of the old key while both are listed: %v", err)
+	}
+	if _, _, _, err = after.parse(current); err != nil {
+		t.Errorf("token of the new key after the old one is removed: %v", err)
+	}
+	if _, _, _, err = after.parse(old); err == nil {
+		t.Error("token of a removed key was accepted")
+	}
+	if _, _, _, err = before.parse(current); err == nil {
+		t.Error("token of a key the instance does not know yet was accepted")
+	}
+}
+
+func TestNewJWTIssuerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		c    JWTConfig
+	}{
+		{"unknown algorithm", JWTConfig{Algorithm: "RS256", ActiveKID: "k1", Keys: []JWTKey{{KID: "k1", Key: testJWTKey('a')}}}},
+		{"active key missing", JWTConfig{Algorithm: "EdDSA", ActiveKID: "k2", Keys: []JWTKey{{KID: "k1", Key: testJWTKey('a')}}}},
+		{"short seed", JWTConfig{Algorithm: "EdDSA", ActiveKID: "k1", Keys: []JWTKey{{KID: "k1", Key: "c2hvcnQ="}}}},
+		{"short secret", JWTConfig{Algorithm: "HS256", ActiveKID: "k1", Keys: []JWTKey{{KID: "k1", Key: "c2hvcnQ="}}}},
+		{"not base64", JWTConfig{Algorithm: "HS256", ActiveKID: "k1", Keys: []JWTKey{{KID: "k1", Key: "%%%"}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newJWTIssuer(tt.c); err == nil {
+				t.Error("newJWTIssuer succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestDenylist(t *testing.T) {
+	d := newDenylist()
+	d.add("revoked", time.Now().Add(time.Hour))
+	if !d.has("revoked") || d.has("other") {
+		t.Fatal("has does not match the added entries")
+	}
+
+	d.merge(map[string]time.Time{
+		"from another instance": time.Now().Add(time.Hour),
+		"expired":               time.Now().Add(-time.Minute),
+	})
+	if !d.has("from another instance") {
+		t.Error("merged entry is missing")
+	}
+	if d.has("expired") {
+		t.Error("expired entry was kept")
+	}
+}
+
+func TestSyncDenylist(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		s.Auth.Mode = AuthModeJWT
+		s.Auth.JWT = JWTConfig{
+			Algorithm: "EdDSA", Issuer: "todo-backend", ActiveKID: "k1",
+			Keys: []JWTKey{{KID: "k1", Key: testJWTKey('a')}},
+		}
+	})
+	u, _ := ts.createUser(t, "ann@example.com", "", true)
+
+	expire := time.Now().UTC().Add(time.Hour)
+	token, err := ts.jwt.sign(u.ID, "jti-1", expire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Tokens.Create("jti-1", u.ID, expire, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if r := ts.do(t, "GET", "/api/auth", token, nil); r.status != 200 {
+		t.Fatalf("GET /api/auth = %d %s, want 200", r.status, r.body)
+	}
+
+	// Another instance revokes the session: only the database knows.
+	if err = ts.Tokens.Deny(storage.HashToken("jti-1"), expire); err != nil {
+		t.Fatal(err)
+	}
+	if ts.denylist.has(storage.HashToken("jti-1")) {
+		t.Fatal("denylist changed before the sync")
+	}
+	ts.syncDenylist()
+	if !ts.denylist.has(storage.HashToken("jti-1")) {
+		t.Fatal("denylist misses the entry after the sync")
+	}
+	if r := ts.do(t, "GET", "/api/auth", token, nil); r.status != 401 {
+		t.Errorf("GET /api/auth with a denied JWT = %d %s, want 401", r.status, r.body)
+	}
+}
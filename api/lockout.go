@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/valyala/fasthttp"
+)
+
+// LockoutConfig limits password and code guessing. Once an account or an IP
+// address reaches its threshold of failed attempts, it is locked for
+// BaseDelay, doubled with every further failure up to MaxDelay.
+type LockoutConfig struct {
+	// AccountThreshold and IPThreshold are the failures allowed before the
+	// first lockout. Zero disables the counter.
+	AccountThreshold int
+	IPThreshold      int
+	// ResetEmailThreshold and ResetIPThreshold are the password reset
+	// requests allowed per email and per IP address before they are locked
+	// the same way. Zero disables the counter.
+	ResetEmailThreshold int
+	ResetIPThreshold    int
+	// ResendUserThreshold and ResendIPThreshold limit the verification mails
+	// sent again per user and per IP address in the same way.
+	ResendUserThreshold int
+	ResendIPThreshold   int
+	BaseDelay           time.Duration
+	MaxDelay            time.Duration
+	// Window is how long failures are remembered after the last one.
+	Window time.Duration
+}
+
+// lockDelay returns how long to lock a key after failures failed attempts.
+func (c LockoutConfig) lockDelay(failures, threshold int) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+
+	delay := c.BaseDelay
+	for i := threshold; i < failures && delay < c.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+
+	return delay
+}
+
+type attemptKey struct {
+	key       string
+	threshold int
+	account   bool
+}
+
+// attemptKeys returns the failure counters of a login as email from the
+// client of ctx. Emails are counted whether or not an account exists.
+func (s *Server) attemptKeys(ctx *fasthttp.RequestCtx, email string) []attemptKey {
+	_, ip := clientInfo(ctx)
+	return []attemptKey{
+		{key: "account:" + strings.ToLower(email), threshold: s.Auth.Lockout.AccountThreshold, account: true},
+		{key: "ip:" + ip, threshold: s.Auth.Lockout.IPThreshold},
+	}
+}
+
+// resetKeys returns the counters of password reset requests for email from
+// the client of ctx. They are kept apart from the login counters, so asking
+// for resets cannot lock anyone out of logging in.
+func (s *Server) resetKeys(ctx *fasthttp.RequestCtx, email string) []attemptKey {
+	_, ip := clientInfo(ctx)
+	return []attemptKey{
+		{key: "reset:" + strings.ToLower(email), threshold: s.Auth.Lockout.ResetEmailThreshold},
+		{key: "reset-ip:" + ip, threshold: s.Auth.Lockout.ResetIPThreshold},
+	}
+}
+
+// resendKeys returns the counters of verification mails sent again to the
+// user from the client of ctx.
+func (s *Server) resendKeys(ctx *fasthttp.RequestCtx, userId uint64) []attemptKey {
+	_, ip := clientInfo(ctx)
+	return []attemptKey{
+		{key: "resend:" + strconv.FormatUint(userId, 10), threshold: s.Auth.Lockout.ResendUserThreshold},
+		{key: "resend-ip:" + ip, threshold: s.Auth.Lockout.ResendIPThreshold},
+	}
+}
+
+// checkLockout responds with too_many_attempts and a Retry-After header and
+// returns false while any of keys is locked.
+func (s *Server) checkLockout(ctx *fasthttp.RequestCtx, keys []attemptKey) bool {
+	now := time.Now().UTC()
+	var retryAfter time.Duration
+	for _, k := range keys {
+		if k.threshold <= 0 {
+			continue
+		}
+
+		a, err := s.Attempts.Get(k.key)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return false
+		}
+
+		if a.LockedUntil != nil && a.LockedUntil.After(now) {
+			if wait := a.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+
+	if retryAfter > 0 {
+		ctx.Response.Header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		errorResponse(ctx, fasthttp.StatusTooManyRequests, "Too many failed attempts", TooManyAttempts)
+		return false
+	}
+
+	return true
+}
+
+// failAttempt counts a failed attempt on keys and locks those that reached
+// their threshold.
+func (s *Server) failAttempt(keys []attemptKey) {
+	now := time.Now().UTC()
+	for _, k := range keys {
+		if k.threshold <= 0 {
+			continue
+		}
+
+		failures, err := s.Attempts.Fail(k.key, now.Add(s.Auth.Lockout.Window))
+		if err != nil {
+			continue
+		}
+
+		if delay := s.Auth.Lockout.lockDelay(failures, k.threshold); delay > 0 {
+			if err = s.Attempts.Lock(k.key, now.Add(delay)); err == nil {
+				log.Printf("locked %s for %s after %d failed attempts", k.key, delay, failures)
+			}
+		}
+	}
+}
+
+// resetAttempts forgets the failures of the account after a successful login.
+// The IP counter is kept, so logging in to an own account does not allow
+// further guessing on others.
+func (s *Server) resetAttempts(keys []attemptKey) {
+	for _, k := range keys {
+		if k.account && k.threshold > 0 {
+			_ = s.Attempts.Reset(k.key)
+		}
+	}
+}
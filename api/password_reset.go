@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+type forgotPassword struct {
+	Email string `json:"email"`
+}
+
+func (s *Server) handleForgotPassword(ctx *fasthttp.RequestCtx) {
+	var fp forgotPassword
+	json.Unmarshal(ctx.PostBody(), &fp)
+
+	// Every request counts against the email and the address, whether or not
+	// the account exists, so the limit does not tell them apart either.
+	keys := s.resetKeys(ctx, fp.Email)
+	if !s.checkLockout(ctx, keys) {
+		return
+	}
+	s.failAttempt(keys)
+
+	// The response is the same whether or not the account exists, and the
+	// lookup and the mail happen after it, so neither its content nor its
+	// timing can be used to find out which emails are registered.
+	go s.sendPasswordReset(fp.Email)
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+// sendPasswordReset mails a reset link to the account of email, if there is
+// one.
+func (s *Server) sendPasswordReset(email string) {
+	user, err := s.Users.GetByEmail(email)
+	if err != nil {
+		return
+	}
+
+	token, err := generateRandomToken()
+	if err != nil {
+		log.Println("password reset error: ", err)
+		return
+	}
+
+	expire := time.Now().UTC().Add(s.Auth.PasswordResetLifetime)
+	if err = s.PasswordResets.Create(token, user.ID, expire); err != nil {
+		log.Println("password reset error: ", err)
+		return
+	}
+
+	link := s.PublicURL + "/reset-password?token=" + url.QueryEscape(token)
+	s.sendMail(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Someone asked to reset the password of your account. To choose a new password, open\n\n%s\n\n"+
+				"The link is valid for %.0f minutes and can be used once. If it was not you, ignore this email.",
+			link, s.Auth.PasswordResetLifetime.Minutes(),
+		),
+	})
+}
+
+type resetPassword struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (s *Server) handleResetPassword(ctx *fasthttp.RequestCtx) {
+	var rp resetPassword
+	json.Unmarshal(ctx.PostBody(), &rp)
+
+	r, err := s.PasswordResets.GetByToken(rp.Token)
+	if err != nil || r.Used || !time.Now().UTC().Before(r.Expire) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return
+	}
+
+	u, err := s.Users.GetById(r.UserID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return
+	}
+
+	if !s.checkPasswordPolicy(ctx, rp.Password, u.Email) {
+		return
+	}
+
+	hashPass, err := s.Hasher.Hash(rp.Password)
+	if err != nil {
+		log.Println("password hash error: ", err)
+		errorResponse(ctx, fasthttp.StatusInternalServerError, "password hash error", "")
+		return
+	}
+
+	used, err := s.PasswordResets.Use(r.ID, u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if !used {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return
+	}
+
+	err = s.Users.EditPassword(u.ID, hashPass)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	// Whoever knew the old password is logged out; no session has ID 0.
+	_, err = s.revokeOtherSessions(u.ID, 0)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.resetAttempts(s.attemptKeys(ctx, u.Email))
+	s.recordEvent(ctx, u.ID, u.Email, types.EventPasswordReset, "")
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+// Scopes that personal access tokens can be granted. Every authorized route
+// declares the scope it requires; session tokens have all of them.
+const (
+	ScopeTodosRead  = "todos:read"
+	ScopeTodosWrite = "todos:write"
+	ScopeAccount    = "account"
+
+	// scopeSession marks routes that need a login session. It cannot be
+	// granted, so personal access tokens never reach these routes.
+	scopeSession = "session"
+)
+
+// personalTokenPrefix tells personal access tokens apart from session tokens.
+const personalTokenPrefix = "pat_"
+
+var grantableScopes = []string{ScopeTodosRead, ScopeTodosWrite, ScopeAccount}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type createPersonalToken struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	Expire string   `json:"expire,omitempty"`
+}
+
+type personalTokenResponse struct {
+	types.PersonalToken
+	Token string `json:"token"`
+}
+
+func (s *Server) handleCreatePersonalToken(ctx *fasthttp.RequestCtx) {
+	var pt createPersonalToken
+	json.Unmarshal(ctx.PostBody(), &pt)
+
+	if len(pt.Name) > 255 {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid name", "")
+		return
+	}
+
+	scopes := make([]string, 0, len(pt.Scopes))
+	for _, scope := range pt.Scopes {
+		if !hasScope(grantableScopes, scope) {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid scope "+scope, InvalidScope)
+			return
+		}
+		if !hasScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid scopes", InvalidScope)
+		return
+	}
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	var expire *time.Time
+	if pt.Expire != "" {
+		expireTime, err := parseTime(u, pt.Expire, "")
+		if err != nil || !expireTime.After(time.Now()) {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidDate)
+			return
+		}
+		expire = &expireTime
+	}
+
+	randomToken, err := generateRandomToken()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	token := personalTokenPrefix + randomToken
+
+	err = s.PersonalTokens.Create(token, pt.Name, scopes, expire, u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	created, err := s.PersonalTokens.GetByToken(token)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	loc := userLocation(u)
+	inZone(loc, &created.Created)
+	inZoneOptional(loc, &created.LastUsed, &created.Expire)
+
+	// Only the hash of the token is stored, so it cannot be shown again.
+	okResponse(ctx, fasthttp.StatusCreated, personalTokenResponse{PersonalToken: *created, Token: token})
+}
+
+func (s *Server) handleGetPersonalTokens(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	tokens, err := s.PersonalTokens.GetAllByUser(u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	loc := userLocation(u)
+	for i := range tokens {
+		inZone(loc, &tokens[i].Created)
+		inZoneOptional(loc, &tokens[i].LastUsed, &tokens[i].Expire)
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, tokens)
+}
+
+func (s *Server) handleDeletePersonalToken(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	idStr := ctx.UserValue("id").(string)
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid ID", "")
+		return
+	}
+
+	_, err = s.PersonalTokens.GetByUserId(id, u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusNotFound, "", NotFound)
+		return
+	}
+
+	err = s.PersonalTokens.Delete(id, u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.recordEvent(ctx, u.ID, u.Email, types.EventPersonalTokenRevoke, "")
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+// authorizePersonalToken checks a personal access token for the scope of the
+// route and stores its user for getUserByToken.
+func (s *Server) authorizePersonalToken(ctx *fasthttp.RequestCtx, pat *types.PersonalToken, scope string) bool {
+	now := time.Now().UTC()
+	if pat.Expire != nil && !now.Before(*pat.Expire) {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return false
+	}
+
+	if scope == scopeSession {
+		errorResponse(ctx, fasthttp.StatusForbidden, "Personal access tokens cannot be used here", InsufficientScope)
+		return false
+	}
+	if !hasScope(pat.Scopes, scope) {
+		errorResponse(ctx, fasthttp.StatusForbidden, "Token lacks scope "+scope, InsufficientScope)
+		return false
+	}
+
+	if pat.LastUsed == nil || now.Sub(*pat.LastUsed) >= s.Auth.RenewInterval {
+		_ = s.PersonalTokens.Touch(pat.ID, now)
+	}
+
+	ctx.SetUserValue("user_id", pat.UserID)
+	return true
+}
+
+func isPersonalToken(token string) bool {
+	return strings.HasPrefix(token, personalTokenPrefix)
+}
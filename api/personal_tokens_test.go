@@ -0,0 +1,30 @@
+package api
+
+import "testing"
+
+func TestAccountScopeExcludesSessions(t *testing.T) {
+	ts := newTestServer(t, nil)
+	u, _ := ts.createUser(t, "ann@example.com", "", true)
+
+	token := personalTokenPrefix + "account"
+	if err := ts.PersonalTokens.Create(token, "script", []string{ScopeAccount}, nil, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := ts.do(t, "GET", "/api/profile", token, nil); r.status != 200 {
+		t.Fatalf("GET /api/profile = %d %s, want 200", r.status, r.body)
+	}
+	for _, tt := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{"GET", "/api/sessions", nil},
+		{"PUT", "/api/sessions/1", renameSession{Name: "laptop"}},
+		{"DELETE", "/api/sessions/1", nil},
+		{"POST", "/api/sessions/revoke-others", nil},
+	} {
+		if r := ts.do(t, tt.method, tt.path, token, tt.body); r.status != 403 || r.code != InsufficientScope {
+			t.Errorf("%s %s = %d %s, want 403 %s", tt.method, tt.path, r.status, r.body, InsufficientScope)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	// Time zones must load on hosts without a zoneinfo database too.
+	_ "time/tzdata"
+	"unicode/utf8"
+
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+	"golang.org/x/text/language"
+)
+
+var weekdays = map[string]bool{
+	"monday": true, "tuesday": true, "wednesday": true, "thursday": true,
+	"friday": true, "saturday": true, "sunday": true,
+}
+
+func (s *Server) handleGetProfile(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, u.Profile)
+}
+
+// editProfile holds the fields of a PATCH /api/profile; fields that are left
+// out keep their value.
+type editProfile struct {
+	DisplayName *string `json:"display_name"`
+	TimeZone    *string `json:"time_zone"`
+	Locale      *string `json:"locale"`
+	WeekStart   *string `json:"week_start"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+func (s *Server) handleEditProfile(ctx *fasthttp.RequestCtx) {
+	var ep editProfile
+	if err := json.Unmarshal(ctx.PostBody(), &ep); err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid body", "")
+		return
+	}
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	p := u.Profile
+	if ep.DisplayName != nil {
+		name := strings.TrimSpace(*ep.DisplayName)
+		if utf8.RuneCountInString(name) > 100 {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "Display name is longer than 100 characters", InvalidDisplayName)
+			return
+		}
+		p.DisplayName = name
+	}
+	if ep.TimeZone != nil {
+		if _, err := loadLocation(*ep.TimeZone); err != nil {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "Unknown time zone", InvalidTimeZone)
+			return
+		}
+		p.TimeZone = *ep.TimeZone
+	}
+	if ep.Locale != nil {
+		tag, err := language.Parse(*ep.Locale)
+		if err != nil || len(*ep.Locale) > 35 {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid locale", InvalidLocale)
+			return
+		}
+		p.Locale = tag.String()
+	}
+	if ep.WeekStart != nil {
+		day := strings.ToLower(*ep.WeekStart)
+		if !weekdays[day] {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "Week start must be the name of a weekday", InvalidWeekStart)
+			return
+		}
+		p.WeekStart = day
+	}
+	if ep.AvatarURL != nil {
+		if *ep.AvatarURL != "" && !validAvatarURL(*ep.AvatarURL) {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "Avatar URL must be an absolute http or https URL", InvalidAvatarURL)
+			return
+		}
+		p.AvatarURL = *ep.AvatarURL
+	}
+
+	if err = s.Users.EditProfile(u.ID, p); err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, p)
+}
+
+func validAvatarURL(raw string) bool {
+	if len(raw) > 2048 {
+		return false
+	}
+
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
+}
+
+var errUnknownTimeZone = errors.New("unknown time zone")
+
+var locations sync.Map // time zone name -> *time.Location
+
+// loadLocation loads an IANA time zone once and keeps it. Unlike
+// time.LoadLocation it refuses "" and "Local", which would mean the
+// server's zone.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, errUnknownTimeZone
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+
+	return loc, nil
+}
+
+// userLocation returns the time zone of the user's profile, or UTC when it
+// cannot be loaded.
+func userLocation(u *types.User) *time.Location {
+	loc, err := loadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// inZone converts times to loc, so responses show them in the user's zone.
+func inZone(loc *time.Location, times ...*time.Time) {
+	for _, t := range times {
+		*t = t.In(loc)
+	}
+}
+
+// inZoneOptional is inZone for optional times. It replaces the pointers
+// instead of writing through them, as they may be shared with the store.
+func inZoneOptional(loc *time.Location, times ...**time.Time) {
+	for _, t := range times {
+		if *t != nil {
+			v := (*t).In(loc)
+			*t = &v
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResponsesInProfileZone(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		s.Auth.AccessTokenLifetime = 15 * time.Minute
+		s.Auth.DeletionGracePeriod = 24 * time.Hour
+	})
+	u, token := ts.createUser(t, "ann@example.com", "", true)
+
+	// Asia/Kolkata has no daylight saving time, so the offset is always the same.
+	const offset = "+05:30"
+	if r := ts.do(t, "PATCH", "/api/profile", token, map[string]string{"time_zone": "Asia/Kolkata"}); r.status != 200 {
+		t.Fatalf("PATCH /api/profile = %d %s", r.status, r.body)
+	}
+
+	checkOffset := func(name, value string) {
+		t.Helper()
+		if !strings.HasSuffix(value, offset) {
+			t.Errorf("%s = %q, want the offset %s", name, value, offset)
+		}
+	}
+
+	r := ts.do(t, "POST", "/api/login", "", authUser{Email: "ann@example.com", Password: testPassword})
+	var login struct {
+		Auth struct {
+			VerifiedAt string `json:"verified_at"`
+		} `json:"auth"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		Expire       string `json:"expire"`
+	}
+	if err := json.Unmarshal(r.body, &login); err != nil || r.status != 200 {
+		t.Fatalf("POST /api/login = %d %s", r.status, r.body)
+	}
+	checkOffset("login expire", login.Expire)
+	checkOffset("login auth.verified_at", login.Auth.VerifiedAt)
+
+	r = ts.do(t, "POST", "/api/token/refresh", "", refreshRequest{RefreshToken: login.RefreshToken})
+	var refresh struct {
+		Expire string `json:"expire"`
+	}
+	if err := json.Unmarshal(r.body, &refresh); err != nil || r.status != 200 {
+		t.Fatalf("POST /api/token/refresh = %d %s", r.status, r.body)
+	}
+	checkOffset("refresh expire", refresh.Expire)
+
+	r = ts.do(t, "DELETE", "/api/account", token, deleteAccount{Password: testPassword})
+	var deleted struct {
+		DeleteAfter string `json:"delete_after"`
+	}
+	if err := json.Unmarshal(r.body, &deleted); err != nil || r.status != 200 {
+		t.Fatalf("DELETE /api/account = %d %s", r.status, r.body)
+	}
+	checkOffset("delete_after", deleted.DeleteAfter)
+
+	secret, err := newTOTPSecret()
+	if err == nil {
+		err = ts.TwoFactor.SetSecret(u.ID, secret)
+	}
+	if err == nil {
+		err = ts.TwoFactor.Enable(u.ID, 0, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = ts.do(t, "POST", "/api/login", "", authUser{Email: "ann@example.com", Password: testPassword})
+	var challenge struct {
+		Expire string `json:"expire"`
+	}
+	if err = json.Unmarshal(r.body, &challenge); err != nil || r.status != 200 {
+		t.Fatalf("POST /api/login with two-factor authentication = %d %s", r.status, r.body)
+	}
+	checkOffset("challenge expire", challenge.Expire)
+}
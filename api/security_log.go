@@ -0,0 +1,175 @@
+package api
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+var authEventTypes = map[string]bool{
+	types.EventLogin: true, types.EventLogout: true,
+	types.EventPasswordChange: true, types.EventPasswordReset: true, types.EventEmailChange: true,
+	types.EventTwoFactorEnable: true, types.EventTwoFactorDisable: true,
+	types.EventSessionRevoke: true, types.EventPersonalTokenRevoke: true,
+}
+
+// recordEvent adds an event to the security log. userId is zero when email
+// does not belong to any user, and reason is the error code of a failure or
+// empty on success. A failure to record is logged rather than failing a
+// request that already happened.
+func (s *Server) recordEvent(ctx *fasthttp.RequestCtx, userId uint64, email, eventType, reason string) {
+	userAgent, ip := clientInfo(ctx)
+	e := types.AuthEvent{
+		Email:     email,
+		Type:      eventType,
+		Outcome:   types.OutcomeSuccess,
+		Reason:    reason,
+		IP:        ip,
+		UserAgent: userAgent,
+		Created:   time.Now().UTC(),
+	}
+	if userId != 0 {
+		e.UserID = &userId
+	}
+	if reason != "" {
+		e.Outcome = types.OutcomeFailure
+	}
+	if len(e.Email) > 255 {
+		e.Email = e.Email[:255]
+	}
+
+	if err := s.AuthEvents.Record(e); err != nil {
+		log.Println("auth event error: ", err)
+	}
+}
+
+// recordLoginFailure records a failed login as email, which may not belong to
+// any user.
+func (s *Server) recordLoginFailure(ctx *fasthttp.RequestCtx, email, reason string) {
+	var userId uint64
+	if u, err := s.Users.GetByEmail(email); err == nil {
+		userId = u.ID
+	}
+
+	s.recordEvent(ctx, userId, email, types.EventLogin, reason)
+}
+
+// lockedOut reports whether checkLockout refused the request because of too
+// many failed attempts, rather than because of an error.
+func lockedOut(ctx *fasthttp.RequestCtx) bool {
+	return ctx.Response.StatusCode() == fasthttp.StatusTooManyRequests
+}
+
+// handleGetSecurityLog lists the events of the user's own account, newest
+// first.
+func (s *Server) handleGetSecurityLog(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	f, ok := authEventFilter(ctx)
+	if !ok {
+		return
+	}
+	f.UserID = u.ID
+	f.Email, f.IP = "", ""
+
+	page, limit := eventPage(ctx)
+	events, err := s.AuthEvents.Search(f, page, limit)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	loc := userLocation(u)
+	for i := range events.Items {
+		inZone(loc, &events.Items[i].Created)
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, events)
+}
+
+// handleAdminAuthEvents searches the security log of every account.
+func (s *Server) handleAdminAuthEvents(ctx *fasthttp.RequestCtx) {
+	f, ok := authEventFilter(ctx)
+	if !ok {
+		return
+	}
+
+	if v := ctx.QueryArgs().Peek("user_id"); len(v) > 0 {
+		id, err := ctx.QueryArgs().GetUint("user_id")
+		if err != nil || id <= 0 {
+			errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid user ID", "")
+			return
+		}
+		f.UserID = uint64(id)
+	}
+
+	page, limit := eventPage(ctx)
+	events, err := s.AuthEvents.Search(f, page, limit)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, events)
+}
+
+// authEventFilter reads the type, outcome, email, ip, since and until query
+// parameters, or responds with an error and returns false.
+func authEventFilter(ctx *fasthttp.RequestCtx) (types.AuthEventFilter, bool) {
+	args := ctx.QueryArgs()
+	f := types.AuthEventFilter{
+		Type:    string(args.Peek("type")),
+		Outcome: string(args.Peek("outcome")),
+		Email:   strings.TrimSpace(string(args.Peek("email"))),
+		IP:      strings.TrimSpace(string(args.Peek("ip"))),
+	}
+
+	if f.Type != "" && !authEventTypes[f.Type] {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Unknown event type", "")
+		return f, false
+	}
+	if f.Outcome != "" && f.Outcome != types.OutcomeSuccess && f.Outcome != types.OutcomeFailure {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Outcome must be success or failure", "")
+		return f, false
+	}
+
+	for _, p := range []struct {
+		name string
+		t    **time.Time
+	}{{"since", &f.Since}, {"until", &f.Until}} {
+		v := args.Peek(p.name)
+		if len(v) == 0 {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, string(v))
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusBadRequest, p.name+" must be an RFC 3339 time", InvalidDate)
+			return f, false
+		}
+		t = t.UTC()
+		*p.t = &t
+	}
+
+	return f, true
+}
+
+func eventPage(ctx *fasthttp.RequestCtx) (page, limit int) {
+	args := ctx.QueryArgs()
+	limit = args.GetUintOrZero("limit")
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	page = args.GetUintOrZero("page")
+	if page <= 0 {
+		page = 1
+	}
+
+	return page, limit
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+// events returns the user's events of the type, newest first.
+func (ts *testServer) events(t *testing.T, userId uint64, eventType string) []types.AuthEvent {
+	t.Helper()
+
+	data, err := ts.AuthEvents.Search(types.AuthEventFilter{UserID: userId, Type: eventType}, 1, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data.Items
+}
+
+func TestEmailChangeWrongPasswordLogged(t *testing.T) {
+	ts := newTestServer(t, nil)
+	u, token := ts.createUser(t, "ann@example.com", "", true)
+
+	r := ts.do(t, "POST", "/api/settings/email", token, changeEmail{Password: "wrong", Email: "new@example.com"})
+	if r.status != 400 || r.code != InvalidCredentials {
+		t.Fatalf("POST /api/settings/email = %d %s, want 400 %s", r.status, r.body, InvalidCredentials)
+	}
+
+	events := ts.events(t, u.ID, types.EventEmailChange)
+	if len(events) != 1 || events[0].Outcome != types.OutcomeFailure || events[0].Reason != InvalidCredentials {
+		t.Errorf("email change events = %+v, want one failure with %s", events, InvalidCredentials)
+	}
+}
+
+func TestJWTLogoutAfterRefreshLogged(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		s.Auth.AccessTokenLifetime = 15 * time.Minute
+		s.Auth.Mode = AuthModeJWT
+		s.Auth.JWT = JWTConfig{
+			Algorithm: "EdDSA", Issuer: "todo-backend", ActiveKID: "k1",
+			Keys: []JWTKey{{KID: "k1", Key: testJWTKey('a')}},
+		}
+	})
+	u, _ := ts.createUser(t, "ann@example.com", "", true)
+
+	r := ts.do(t, "POST", "/api/login", "", authUser{Email: "ann@example.com", Password: testPassword})
+	var login authResponse
+	if err := json.Unmarshal(r.body, &login); err != nil || r.status != 200 {
+		t.Fatalf("POST /api/login = %d %s", r.status, r.body)
+	}
+	if r = ts.do(t, "POST", "/api/token/refresh", "", refreshRequest{RefreshToken: login.RefreshToken}); r.status != 200 {
+		t.Fatalf("POST /api/token/refresh = %d %s", r.status, r.body)
+	}
+
+	// Another instance has not synced the denylist yet, so the old JWT still
+	// passes and its session is gone.
+	ts.denylist = newDenylist()
+	if r = ts.do(t, "POST", "/api/logout", login.Token, nil); r.status != 200 {
+		t.Fatalf("POST /api/logout with the old JWT = %d %s, want 200", r.status, r.body)
+	}
+
+	if events := ts.events(t, u.ID, types.EventLogout); len(events) != 1 {
+		t.Errorf("logout events = %+v, want one", events)
+	}
+}
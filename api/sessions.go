@@ -0,0 +1,243 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+type sessionResponse struct {
+	types.Token
+	Current bool `json:"current"`
+}
+
+func (s *Server) handleGetSessions(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	tokens, err := s.Tokens.GetAllByUser(u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	currentHash := storage.HashToken(ctx.UserValue("token").(string))
+	sessions := make([]sessionResponse, 0, len(tokens))
+	loc := userLocation(u)
+	for _, t := range tokens {
+		inZone(loc, &t.Created, &t.LastUsed, &t.Expire)
+		inZoneOptional(loc, &t.SessionExpire)
+		sessions = append(sessions, sessionResponse{Token: t, Current: t.TokenHash == currentHash})
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, sessions)
+}
+
+type renameSession struct {
+	Name string `json:"name"`
+}
+
+func (s *Server) handleRenameSession(ctx *fasthttp.RequestCtx) {
+	var rs renameSession
+	json.Unmarshal(ctx.PostBody(), &rs)
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	if len(rs.Name) > 255 {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid name", "")
+		return
+	}
+
+	idStr := ctx.UserValue("id").(string)
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid ID", "")
+		return
+	}
+
+	_, err = s.Tokens.GetByUserId(id, u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusNotFound, "", NotFound)
+		return
+	}
+
+	err = s.Tokens.EditName(id, u.ID, rs.Name)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+func (s *Server) handleDeleteSession(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	idStr := ctx.UserValue("id").(string)
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Invalid ID", "")
+		return
+	}
+
+	_, err = s.Tokens.GetByUserId(id, u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusNotFound, "", NotFound)
+		return
+	}
+
+	err = s.revokeSession(id, u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.recordEvent(ctx, u.ID, u.Email, types.EventSessionRevoke, "")
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+func (s *Server) handleRevokeOtherSessions(ctx *fasthttp.RequestCtx) {
+	t, err := s.Tokens.GetByToken(ctx.UserValue("token").(string))
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	n, err := s.revokeOtherSessions(u.ID, t.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if n > 0 {
+		s.recordEvent(ctx, u.ID, u.Email, types.EventSessionRevoke, "")
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]int64{"revoked": n})
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type tokenResponse struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	Expire       time.Time `json:"expire"`
+}
+
+func (s *Server) handleRefreshToken(ctx *fasthttp.RequestCtx) {
+	var rr refreshRequest
+	json.Unmarshal(ctx.PostBody(), &rr)
+
+	rt, err := s.Tokens.GetRefresh(rr.RefreshToken)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	// A used refresh token means it was copied, so the whole session is revoked.
+	if rt.Used {
+		s.revokeSession(rt.SessionID, rt.UserID)
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Refresh token reused", RefreshTokenReused)
+		return
+	}
+
+	now := time.Now().UTC()
+	session, err := s.Tokens.GetByUserId(rt.SessionID, rt.UserID)
+	if err != nil || session.SessionExpire == nil || !now.Before(*session.SessionExpire) {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	sessionExpire := s.Auth.tokenExpire(session.Created, now)
+	expire := s.Auth.accessExpire(now, sessionExpire)
+
+	token, key, err := s.issueAccessToken(session.UserID, expire)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	refreshToken, err := generateRandomToken()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	rotated, err := s.Tokens.Rotate(rt.ID, session.ID, key, refreshToken, expire, sessionExpire)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if !rotated {
+		s.revokeSession(rt.SessionID, rt.UserID)
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Refresh token reused", RefreshTokenReused)
+		return
+	}
+	// The session now only knows the new jti, so the JWT issued before it
+	// could not be revoked later and is denied until it expires instead.
+	s.denyTokens(*session)
+
+	// The user is only loaded for the time zone of the response.
+	if u, err := s.Users.GetById(session.UserID); err == nil {
+		inZone(userLocation(u), &expire)
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, tokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		Expire:       expire,
+	})
+}
+
+// revokeSession deletes one of the user's sessions.
+func (s *Server) revokeSession(id, userId uint64) error {
+	t, err := s.Tokens.GetByUserId(id, userId)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.denyTokens(*t)
+	return s.Tokens.DeleteById(id, userId)
+}
+
+// revokeOtherSessions deletes every session of the user except keepId.
+func (s *Server) revokeOtherSessions(userId, keepId uint64) (int64, error) {
+	if s.jwt != nil {
+		tokens, err := s.Tokens.GetAllByUser(userId)
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range tokens {
+			if t.ID != keepId {
+				s.denyTokens(t)
+			}
+		}
+	}
+
+	return s.Tokens.DeleteOthers(userId, keepId)
+}
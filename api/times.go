@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+// localLayouts are the forms a time without a UTC offset can be given in.
+var localLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+}
+
+var errNonexistentTime = errors.New("local time does not exist")
+
+// parseTime parses a time sent by the user and returns it in UTC. Times in
+// RFC 3339 form carry their own offset; local times such as
+// "2006-01-02 15:04:05" are read in the zone named by zone, or in the
+// user's profile time zone when zone is empty.
+func parseTime(u *types.User, value, zone string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.UTC(), nil
+	}
+
+	loc := userLocation(u)
+	if zone != "" {
+		var err error
+		loc, err = loadLocation(zone)
+		if err != nil {
+			return time.Time{}, errUnknownTimeZone
+		}
+	}
+
+	for _, layout := range localLayouts {
+		// Parsed in UTC only to get at the wall clock fields.
+		wall, err := time.Parse(layout, value)
+		if err == nil {
+			return resolveLocal(wall, loc)
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", value)
+}
+
+// resolveLocal returns the instant at which the clocks in loc show the wall
+// clock time of wall, read as if it were UTC. When clocks are turned back
+// and the time occurs twice, the earlier instant is used. When clocks are
+// turned forward and the time is skipped, errNonexistentTime is returned
+// instead of guessing, as time.Date would.
+func resolveLocal(wall time.Time, loc *time.Location) (time.Time, error) {
+	var found time.Time
+	// The offsets in effect around the time cover both sides of a transition.
+	for _, probe := range []time.Time{wall.Add(-48 * time.Hour), wall, wall.Add(48 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		t := wall.Add(-time.Duration(offset) * time.Second)
+
+		y, m, d := t.In(loc).Date()
+		h, mi, sec := t.In(loc).Clock()
+		if y != wall.Year() || m != wall.Month() || d != wall.Day() ||
+			h != wall.Hour() || mi != wall.Minute() || sec != wall.Second() {
+			continue
+		}
+		if found.IsZero() || t.Before(found) {
+			found = t
+		}
+	}
+	if found.IsZero() {
+		return time.Time{}, errNonexistentTime
+	}
+
+	return found.UTC(), nil
+}
+
+// timeErrorResponse explains why parseTime refused a time.
+func timeErrorResponse(ctx *fasthttp.RequestCtx, err error) {
+	switch {
+	case errors.Is(err, errUnknownTimeZone):
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Unknown time zone", InvalidTimeZone)
+	case errors.Is(err, errNonexistentTime):
+		errorResponse(ctx, fasthttp.StatusBadRequest, "The time is skipped by a daylight saving change in this time zone", InvalidDate)
+	default:
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidDate)
+	}
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+func TestParseTime(t *testing.T) {
+	berlin := &types.User{Profile: types.Profile{TimeZone: "Europe/Berlin"}}
+	utc := &types.User{Profile: types.Profile{TimeZone: "UTC"}}
+
+	tests := []struct {
+		name  string
+		user  *types.User
+		value string
+		zone  string
+		want  string
+		err   error
+	}{
+		{"RFC 3339 with Z", berlin, "2026-07-01T12:00:00Z", "", "2026-07-01T12:00:00Z", nil},
+		{"RFC 3339 with positive offset", utc, "2026-07-01T12:00:00+05:30", "", "2026-07-01T06:30:00Z", nil},
+		{"RFC 3339 with negative offset", utc, "2026-07-01T12:00:00-07:00", "", "2026-07-01T19:00:00Z", nil},
+		{"RFC 3339 ignores the zone", utc, "2026-07-01T12:00:00Z", "Asia/Tokyo", "2026-07-01T12:00:00Z", nil},
+
+		{"local with seconds and space", berlin, "2026-07-01 12:00:30", "", "2026-07-01T10:00:30Z", nil},
+		{"local with seconds and T", berlin, "2026-07-01T12:00:30", "", "2026-07-01T10:00:30Z", nil},
+		{"local without seconds and space", berlin, "2026-07-01 12:00", "", "2026-07-01T10:00:00Z", nil},
+		{"local without seconds and T", berlin, "2026-07-01T12:00", "", "2026-07-01T10:00:00Z", nil},
+		{"local in winter", berlin, "2026-01-15 12:00", "", "2026-01-15T11:00:00Z", nil},
+
+		{"zone overrides the profile", berlin, "2026-07-01 12:00", "America/New_York", "2026-07-01T16:00:00Z", nil},
+		{"zone on a UTC profile", utc, "2026-07-01 12:00", "Asia/Tokyo", "2026-07-01T03:00:00Z", nil},
+		{"unknown zone", berlin, "2026-07-01 12:00", "Mars/Olympus", "", errUnknownTimeZone},
+		{"Local is not a zone", berlin, "2026-07-01 12:00", "Local", "", errUnknownTimeZone},
+
+		{"spring forward gap in Berlin", berlin, "2026-03-29 02:30", "", "", errNonexistentTime},
+		{"spring forward gap in New York", utc, "2026-03-08 02:30", "America/New_York", "", errNonexistentTime},
+		{"spring forward gap in Sydney", utc, "2026-10-04 02:30", "Australia/Sydney", "", errNonexistentTime},
+		{"just before the gap", berlin, "2026-03-29 01:59:59", "", "2026-03-29T00:59:59Z", nil},
+		{"end of the gap", berlin, "2026-03-29 03:00", "", "2026-03-29T01:00:00Z", nil},
+
+		{"fall back overlap in Berlin", berlin, "2026-10-25 02:30", "", "2026-10-25T00:30:00Z", nil},
+		{"fall back overlap in New York", utc, "2026-11-01 01:30", "America/New_York", "2026-11-01T05:30:00Z", nil},
+		{"fall back overlap in Sydney", utc, "2026-04-05 02:30", "Australia/Sydney", "2026-04-04T15:30:00Z", nil},
+		{"half hour overlap on Lord Howe", utc, "2026-04-05 01:45", "Australia/Lord_Howe", "2026-04-04T14:45:00Z", nil},
+		{"after the overlap", berlin, "2026-10-25 03:00", "", "2026-10-25T02:00:00Z", nil},
+
+		{"not a time", berlin, "tomorrow", "", "", nil},
+		{"date only", berlin, "2026-07-01", "", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTime(tt.user, tt.value, tt.zone)
+			if tt.want == "" {
+				if err == nil {
+					t.Fatalf("parseTime(%q, %q) = %s, want an error", tt.value, tt.zone, got)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Fatalf("parseTime(%q, %q) error = %v, want %v", tt.value, tt.zone, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTime(%q, %q) error = %v", tt.value, tt.zone, err)
+			}
+
+			want, _ := time.Parse(time.RFC3339, tt.want)
+			if !got.Equal(want) || got.Location() != time.UTC {
+				t.Errorf("parseTime(%q, %q) = %s, want %s", tt.value, tt.zone, got, want)
+			}
+		})
+	}
+}
@@ -13,21 +13,23 @@ type createTodo struct {
 	Title  string `json:"title"`
 	Note   string `json:"note"`
 	Expire string `json:"expire"`
+	// TimeZone reads a local Expire in this zone instead of the profile's.
+	TimeZone string `json:"time_zone,omitempty"`
 }
 
 func (s *Server) handleCreateTodo(ctx *fasthttp.RequestCtx) {
 	var todo createTodo
 	json.Unmarshal(ctx.PostBody(), &todo)
 
-	expireTime, err := time.Parse("2006-01-02 15:04:05", todo.Expire)
+	u, err := s.getUserByToken(ctx)
 	if err != nil {
-		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidDate)
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
 		return
 	}
 
-	u, err := s.getUserByToken(ctx)
+	expireTime, err := parseTime(u, todo.Expire, todo.TimeZone)
 	if err != nil {
-		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		timeErrorResponse(ctx, err)
 		return
 	}
 
@@ -88,33 +90,39 @@ func (s *Server) handleGetTodos(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	loc := userLocation(u)
+	for i := range todoResponse.Items {
+		inZone(loc, &todoResponse.Items[i].Created, &todoResponse.Items[i].Expire)
+	}
+
 	okResponse(ctx, fasthttp.StatusOK, todoResponse)
 }
 
 type editTodo struct {
-	ID     uint64 `json:"id"`
-	Title  string `json:"title"`
-	Note   string `json:"note"`
-	Expire string `json:"expire"`
+	ID       uint64 `json:"id"`
+	Title    string `json:"title"`
+	Note     string `json:"note"`
+	Expire   string `json:"expire"`
+	TimeZone string `json:"time_zone,omitempty"`
 }
 
 func (s *Server) handleEditTodo(ctx *fasthttp.RequestCtx) {
 	var todo editTodo
 	json.Unmarshal(ctx.PostBody(), &todo)
 
-	expireTime, err := time.Parse("2006-01-02 15:04:05", todo.Expire)
+	u, err := s.getUserByToken(ctx)
 	if err != nil {
-		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidDate)
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
 		return
 	}
 
-	u, err := s.getUserByToken(ctx)
+	expireTime, err := parseTime(u, todo.Expire, todo.TimeZone)
 	if err != nil {
-		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		timeErrorResponse(ctx, err)
 		return
 	}
 
-	_, err = s.Todos.GetByUserId(todo.ID, u.ID)
+	old, err := s.Todos.GetByUserId(todo.ID, u.ID)
 	if err != nil {
 		errorResponse(ctx, fasthttp.StatusNotFound, "", NotFound)
 		return
@@ -126,6 +134,21 @@ func (s *Server) handleEditTodo(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
+	// A moved deadline can make an overdue todo active again, or the other way
+	// round, without waiting for the status job.
+	if old.Status != "completed" {
+		status := "active"
+		if time.Now().UTC().After(expireTime) {
+			status = "overdue"
+		}
+		if status != old.Status {
+			if err = s.Todos.EditStatus(todo.ID, u.ID, status); err != nil {
+				errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+				return
+			}
+		}
+	}
+
 	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
 }
 
@@ -152,7 +175,7 @@ func (s *Server) handleCompleteTodo(ctx *fasthttp.RequestCtx) {
 	if todo.Status != "completed" {
 		todo.Status = "completed"
 	} else {
-		if time.Now().After(todo.Expire) {
+		if time.Now().UTC().After(todo.Expire) {
 			todo.Status = "overdue"
 		} else {
 			todo.Status = "active"
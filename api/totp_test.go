@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// The SHA-1 test vectors of RFC 6238 appendix B. The RFC lists eight digit
+// codes; six digit codes are their last six digits.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+const rfc6238Key = "12345678901234567890"
+
+func TestTOTPCode(t *testing.T) {
+	for _, v := range rfc6238Vectors {
+		if code := totpCode([]byte(rfc6238Key), totpStep(time.Unix(v.unix, 0))); code != v.code {
+			t.Errorf("totpCode at %d = %s, want %s", v.unix, code, v.code)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte(rfc6238Key))
+	for _, v := range rfc6238Vectors {
+		if _, ok := validateTOTP(secret, v.code, time.Unix(v.unix, 0)); !ok {
+			t.Errorf("validateTOTP(%s) at %d failed", v.code, v.unix)
+		}
+	}
+
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+	for offset := int64(-2); offset <= 2; offset++ {
+		code := totpCode([]byte(rfc6238Key), current+offset)
+		step, ok := validateTOTP(secret, code, now)
+		want := offset >= -totpSkew && offset <= totpSkew
+		if ok != want || (ok && step != current+offset) {
+			t.Errorf("code of step %+d = %d, %t, want %d, %t", offset, step, ok, current+offset, want)
+		}
+	}
+
+	for _, tt := range []struct{ name, secret, code string }{
+		{"wrong code", secret, "000000"},
+		{"short code", secret, "05047"},
+		{"long code", secret, "0504710"},
+		{"bad secret", "not base32!", "050471"},
+	} {
+		if _, ok := validateTOTP(tt.secret, tt.code, now); ok {
+			t.Errorf("%s: validateTOTP succeeded", tt.name)
+		}
+	}
+}
+
+func TestTwoFactorCodeReplay(t *testing.T) {
+	ts := newTestServer(t, nil)
+	_, token := ts.createUser(t, "ann@example.com", "", true)
+
+	r := ts.do(t, "POST", "/api/2fa/enroll", token, nil)
+	if r.status != 200 {
+		t.Fatalf("POST /api/2fa/enroll = %d %s", r.status, r.body)
+	}
+	var enroll enrollResponse
+	if err := json.Unmarshal(r.body, &enroll); err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpEncoding.DecodeString(enroll.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step := totpStep(time.Now())
+	code := totpCode(key, step)
+	grouped := code[:3] + " " + code[3:]
+	if r = ts.do(t, "POST", "/api/2fa/confirm", token, map[string]string{"code": grouped}); r.status != 200 {
+		t.Fatalf("POST /api/2fa/confirm with %q = %d %s", grouped, r.status, r.body)
+	}
+
+	login := func(code string) testResponse {
+		t.Helper()
+
+		r := ts.do(t, "POST", "/api/login", "", authUser{Email: "ann@example.com", Password: testPassword})
+		var c challengeResponse
+		if err := json.Unmarshal(r.body, &c); err != nil || !c.TwoFactorRequired {
+			t.Fatalf("POST /api/login = %d %s, want a challenge", r.status, r.body)
+		}
+		return ts.do(t, "POST", "/api/login/2fa", "", loginTwoFactor{Challenge: c.Challenge, Code: code})
+	}
+
+	if r = login(code); r.status != 400 || r.code != InvalidCode {
+		t.Errorf("login with the code used to confirm = %d %s, want 400 %s", r.status, r.body, InvalidCode)
+	}
+	next := totpCode(key, step+1)
+	if r = login(next[:3] + "-" + next[3:]); r.status != 200 {
+		t.Fatalf("login with the next code = %d %s, want 200", r.status, r.body)
+	}
+	if r = login(next); r.status != 400 || r.code != InvalidCode {
+		t.Errorf("login with a code used for login = %d %s, want 400 %s", r.status, r.body, InvalidCode)
+	}
+}
@@ -0,0 +1,348 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxChallengeAttempts is how many wrong codes a login challenge takes
+	// before it is dropped and the password has to be entered again.
+	maxChallengeAttempts = 5
+)
+
+type twoFactorStatus struct {
+	Enabled       bool `json:"enabled"`
+	RecoveryCodes int  `json:"recovery_codes"`
+}
+
+func (s *Server) handleGetTwoFactor(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	var status twoFactorStatus
+	tf, err := s.TwoFactor.Get(u.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if err == nil && tf.Enabled {
+		status.Enabled = true
+		status.RecoveryCodes, err = s.TwoFactor.CountRecoveryCodes(u.ID)
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return
+		}
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, status)
+}
+
+type enrollResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+func (s *Server) handleEnrollTwoFactor(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	tf, err := s.TwoFactor.Get(u.ID)
+	if err == nil && tf.Enabled {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", TwoFactorEnabled)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	err = s.TwoFactor.SetSecret(u.ID, secret)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, enrollResponse{
+		Secret: secret,
+		URI:    totpURI(s.Auth.TOTPIssuer, u.Email, secret),
+	})
+}
+
+type confirmTwoFactor struct {
+	Code string `json:"code"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+func (s *Server) handleConfirmTwoFactor(ctx *fasthttp.RequestCtx) {
+	var ct confirmTwoFactor
+	json.Unmarshal(ctx.PostBody(), &ct)
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	tf, err := s.TwoFactor.Get(u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusNotFound, "", NotFound)
+		return
+	}
+	if tf.Enabled {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", TwoFactorEnabled)
+		return
+	}
+
+	step, ok := validateTOTP(tf.Secret, normalizeTOTPCode(ct.Code), time.Now())
+	if !ok {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCode)
+		return
+	}
+
+	codes, err := newRecoveryCodes()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	normalized := make([]string, 0, len(codes))
+	for _, code := range codes {
+		normalized = append(normalized, normalizeRecoveryCode(code))
+	}
+
+	err = s.TwoFactor.Enable(u.ID, step, normalized)
+	if errors.Is(err, storage.ErrNotFound) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", TwoFactorEnabled)
+		return
+	}
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.recordEvent(ctx, u.ID, u.Email, types.EventTwoFactorEnable, "")
+
+	// Recovery codes are stored hashed; this is the user's one chance to save them.
+	okResponse(ctx, fasthttp.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+type disableTwoFactor struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (s *Server) handleDisableTwoFactor(ctx *fasthttp.RequestCtx) {
+	var dt disableTwoFactor
+	json.Unmarshal(ctx.PostBody(), &dt)
+
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	tf, err := s.TwoFactor.Get(u.ID)
+	if err != nil || !tf.Enabled {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", TwoFactorDisabled)
+		return
+	}
+
+	keys := s.attemptKeys(ctx, u.Email)
+	if !s.checkLockout(ctx, keys) {
+		return
+	}
+
+	if !s.checkPassword(dt.Password, u.Password) {
+		s.failAttempt(keys)
+		s.recordEvent(ctx, u.ID, u.Email, types.EventTwoFactorDisable, InvalidCredentials)
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCredentials)
+		return
+	}
+
+	ok, err := s.checkTwoFactorCode(tf, dt.Code)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if !ok {
+		s.failAttempt(keys)
+		s.recordEvent(ctx, u.ID, u.Email, types.EventTwoFactorDisable, InvalidCode)
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCode)
+		return
+	}
+
+	err = s.TwoFactor.Disable(u.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.recordEvent(ctx, u.ID, u.Email, types.EventTwoFactorDisable, "")
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+type challengeResponse struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	Challenge         string    `json:"challenge"`
+	Expire            time.Time `json:"expire"`
+}
+
+// startChallenge answers a login with a correct password for a user with
+// two-factor authentication by a challenge for handleLoginTwoFactor.
+func (s *Server) startChallenge(ctx *fasthttp.RequestCtx, user *types.User) {
+	challenge, err := generateRandomToken()
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	expire := time.Now().UTC().Add(s.Auth.ChallengeLifetime)
+	err = s.TwoFactor.CreateChallenge(challenge, user.ID, expire)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	inZone(userLocation(user), &expire)
+
+	okResponse(ctx, fasthttp.StatusOK, challengeResponse{
+		TwoFactorRequired: true,
+		Challenge:         challenge,
+		Expire:            expire,
+	})
+}
+
+type loginTwoFactor struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+func (s *Server) handleLoginTwoFactor(ctx *fasthttp.RequestCtx) {
+	var lt loginTwoFactor
+	json.Unmarshal(ctx.PostBody(), &lt)
+
+	c, err := s.TwoFactor.GetChallenge(lt.Challenge)
+	if err != nil || !time.Now().UTC().Before(c.Expire) {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "", InvalidChallenge)
+		return
+	}
+
+	tf, err := s.TwoFactor.Get(c.UserID)
+	if err != nil || !tf.Enabled {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "", InvalidChallenge)
+		return
+	}
+
+	user, err := s.Users.GetById(c.UserID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "", InvalidChallenge)
+		return
+	}
+
+	keys := s.attemptKeys(ctx, user.Email)
+	if !s.checkLockout(ctx, keys) {
+		if lockedOut(ctx) {
+			s.recordEvent(ctx, user.ID, user.Email, types.EventLogin, TooManyAttempts)
+		}
+		return
+	}
+
+	ok, err := s.checkTwoFactorCode(tf, lt.Code)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if !ok {
+		s.failAttempt(keys)
+		s.recordEvent(ctx, user.ID, user.Email, types.EventLogin, InvalidCode)
+		if c.Attempts+1 >= maxChallengeAttempts {
+			_, err = s.TwoFactor.DeleteChallenge(c.ID)
+		} else {
+			err = s.TwoFactor.FailChallenge(c.ID)
+		}
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return
+		}
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCode)
+		return
+	}
+
+	// Deleting the challenge makes sure it completes only one login.
+	deleted, err := s.TwoFactor.DeleteChallenge(c.ID)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	if !deleted {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "", InvalidChallenge)
+		return
+	}
+
+	s.resetAttempts(keys)
+	s.startSession(ctx, user)
+}
+
+// checkTwoFactorCode accepts a TOTP code that was not used before or an
+// unused recovery code.
+func (s *Server) checkTwoFactorCode(tf *types.TwoFactor, code string) (bool, error) {
+	code = normalizeTOTPCode(code)
+	if step, ok := validateTOTP(tf.Secret, code, time.Now()); ok {
+		return s.TwoFactor.UseStep(tf.UserID, step)
+	}
+
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+	return s.TwoFactor.UseRecoveryCode(tf.UserID, code)
+}
+
+// newRecoveryCodes returns recoveryCodeCount random codes of the form
+// xxxxx-xxxxx with 50 bits each.
+func newRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+	codes := make([]string, 0, recoveryCodeCount)
+	b := make([]byte, 10)
+	for i := 0; i < recoveryCodeCount; i++ {
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		code := make([]byte, 0, 11)
+		for j, c := range b {
+			if j == 5 {
+				code = append(code, '-')
+			}
+			code = append(code, alphabet[c&31])
+		}
+		codes = append(codes, string(code))
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode drops the separator and case so codes are stored and
+// compared in one form.
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(code, "-", ""))
+}
@@ -1,13 +1,19 @@
 package api
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
-	"math/rand"
+	"errors"
+	"fmt"
+	"log"
 	"regexp"
+	"time"
 
+	"github.com/iwajezhgf/todo-backend/passwords"
+	"github.com/iwajezhgf/todo-backend/storage"
 	"github.com/iwajezhgf/todo-backend/types"
 	"github.com/valyala/fasthttp"
-	"golang.org/x/crypto/bcrypt"
 )
 
 type authUser struct {
@@ -19,15 +25,12 @@ func (s *Server) handleRegister(ctx *fasthttp.RequestCtx) {
 	var u authUser
 	json.Unmarshal(ctx.PostBody(), &u)
 
-	emailRegexp := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegexp.MatchString(u.Email) {
+	if !validEmail(u.Email) {
 		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidEmail)
 		return
 	}
 
-	passRegexp := regexp.MustCompile(`^.{6,}$`)
-	if !passRegexp.MatchString(u.Password) {
-		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidPassword)
+	if !s.checkPasswordPolicy(ctx, u.Password, u.Email) {
 		return
 	}
 
@@ -37,48 +40,176 @@ func (s *Server) handleRegister(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	hashedPassword, _ := hashPassword(u.Password)
+	hashedPassword, err := s.Hasher.Hash(u.Password)
+	if err != nil {
+		log.Println("password hash error: ", err)
+		errorResponse(ctx, fasthttp.StatusInternalServerError, "password hash error", "")
+		return
+	}
 
 	err = s.Users.Create(u.Email, hashedPassword)
+	if errors.Is(err, storage.ErrDuplicate) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", AlreadyExists)
+		return
+	}
 	if err != nil {
 		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
 		return
 	}
 
+	user, err := s.Users.GetByEmail(u.Email)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.sendVerification(user)
+
 	okResponse(ctx, fasthttp.StatusCreated, map[string]string{})
 }
 
+var emailRegexp = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
+func validEmail(email string) bool {
+	return len(email) <= 255 && emailRegexp.MatchString(email)
+}
+
+// checkPasswordPolicy responds with the rule of the password policy that
+// password breaks for the account with the given email and returns false, or
+// returns true when it follows all of them.
+func (s *Server) checkPasswordPolicy(ctx *fasthttp.RequestCtx, password, email string) bool {
+	p := s.Auth.PasswordPolicy
+	err := p.Check(password, email)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, passwords.ErrTooShort):
+		errorResponse(ctx, fasthttp.StatusBadRequest, fmt.Sprintf("Password must be at least %d characters long", p.MinLength), PasswordTooShort)
+	case errors.Is(err, passwords.ErrTooLong):
+		errorResponse(ctx, fasthttp.StatusBadRequest, fmt.Sprintf("Password must be at most %d bytes long", p.MaxLength), PasswordTooLong)
+	case errors.Is(err, passwords.ErrContainsEmail):
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Password must not contain the email address", PasswordContainsEmail)
+	case errors.Is(err, passwords.ErrCommon):
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Password is too common, it appears in lists of leaked passwords", PasswordBreached)
+	default:
+		errorResponse(ctx, fasthttp.StatusBadRequest, "Password is too easy to guess, make it longer or mix in other kinds of characters", PasswordTooWeak)
+	}
+
+	return false
+}
+
 type authResponse struct {
-	Auth  types.User `json:"auth"`
-	Token string     `json:"token"`
+	Auth         types.User `json:"auth"`
+	Token        string     `json:"token"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	Expire       time.Time  `json:"expire"`
 }
 
 func (s *Server) handleLogin(ctx *fasthttp.RequestCtx) {
 	var u authUser
 	json.Unmarshal(ctx.PostBody(), &u)
 
+	keys := s.attemptKeys(ctx, u.Email)
+	if !s.checkLockout(ctx, keys) {
+		if lockedOut(ctx) {
+			s.recordLoginFailure(ctx, u.Email, TooManyAttempts)
+		}
+		return
+	}
+
 	user, err := s.Users.GetByEmail(u.Email)
 	if err != nil {
+		s.failAttempt(keys)
+		s.recordEvent(ctx, 0, u.Email, types.EventLogin, InvalidCredentials)
 		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCredentials)
 		return
 	}
 
-	if !checkPasswordHash(u.Password, user.Password) {
+	match, rehash, err := s.Hasher.Verify(u.Password, user.Password)
+	if err != nil {
+		log.Println("password hash error: ", err)
+	}
+	if !match {
+		s.failAttempt(keys)
+		s.recordEvent(ctx, user.ID, user.Email, types.EventLogin, InvalidCredentials)
 		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCredentials)
 		return
 	}
 
-	randomToken := generateRandomToken(36)
-	err = s.Tokens.Create(randomToken, user.ID)
-	if err != nil {
+	// Hashes made with an older algorithm or weaker parameters are replaced
+	// while the plain password is at hand. Failing that only delays it.
+	if rehash {
+		if hashed, err := s.Hasher.Hash(u.Password); err != nil {
+			log.Println("password hash error: ", err)
+		} else if err = s.Users.EditPassword(user.ID, hashed); err != nil {
+			log.Println("db error: ", err)
+		}
+	}
+
+	tf, err := s.TwoFactor.Get(user.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
 		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
 		return
 	}
+	if err == nil && tf.Enabled {
+		// The account counter is reset once the code is right, too.
+		s.startChallenge(ctx, user)
+		return
+	}
+
+	s.resetAttempts(keys)
+	s.startSession(ctx, user)
+}
+
+// startSession issues the tokens of a new session for a user that has
+// completed login.
+func (s *Server) startSession(ctx *fasthttp.RequestCtx, user *types.User) {
+	if user.DisabledAt != nil {
+		s.recordEvent(ctx, user.ID, user.Email, types.EventLogin, AccountDisabled)
+		errorResponse(ctx, fasthttp.StatusForbidden, "Account is disabled", AccountDisabled)
+		return
+	}
+
+	now := time.Now().UTC()
+	sessionExpire := s.Auth.tokenExpire(now, now)
+	userAgent, ip := clientInfo(ctx)
 
 	response := authResponse{
-		Auth:  *user,
-		Token: randomToken,
+		Auth:   *user,
+		Expire: sessionExpire,
+	}
+	if s.Auth.AccessTokenLifetime > 0 {
+		response.Expire = s.Auth.accessExpire(now, sessionExpire)
+	}
+
+	token, key, err := s.issueAccessToken(user.ID, response.Expire)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
 	}
+	response.Token = token
+
+	if s.Auth.AccessTokenLifetime > 0 {
+		response.RefreshToken, err = generateRandomToken()
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return
+		}
+
+		err = s.Tokens.CreateWithRefresh(
+			key, response.RefreshToken, user.ID, response.Expire, sessionExpire, userAgent, ip,
+		)
+	} else {
+		err = s.Tokens.Create(key, user.ID, sessionExpire, userAgent, ip)
+	}
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+	s.recordEvent(ctx, user.ID, user.Email, types.EventLogin, "")
+
+	loc := userLocation(user)
+	inZone(loc, &response.Expire)
+	inZoneOptional(loc, &response.Auth.VerifiedAt, &response.Auth.DeleteAfter)
 
 	okResponse(ctx, fasthttp.StatusOK, response)
 }
@@ -90,24 +221,52 @@ func (s *Server) handleAuth(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	okResponse(ctx, fasthttp.StatusOK, u)
+	inZoneOptional(userLocation(u), &u.VerifiedAt, &u.DeleteAfter)
+
+	// Apps show a banner while an admin is acting as the user.
+	response := struct {
+		*types.User
+		Impersonation *types.Impersonation `json:"impersonation,omitempty"`
+	}{User: u}
+	if imp, ok := ctx.UserValue("impersonation").(*types.Impersonation); ok {
+		response.Impersonation = imp
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, response)
 }
 
 func (s *Server) handleLogout(ctx *fasthttp.RequestCtx) {
 	token := ctx.UserValue("token").(string)
 	t, err := s.Tokens.GetByToken(token)
+	if errors.Is(err, storage.ErrNotFound) {
+		// A JWT from before the last refresh is denied once its session
+		// rotates, but other instances may not have synced that yet.
+		if expire, ok := ctx.UserValue("token_expire").(time.Time); ok {
+			s.denyTokens(types.Token{TokenHash: storage.HashToken(token), Expire: expire})
+			if u, err := s.Users.GetById(ctx.UserValue("user_id").(uint64)); err == nil {
+				s.recordEvent(ctx, u.ID, u.Email, types.EventLogout, "")
+			}
+			okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+			return
+		}
+	}
 	if err != nil {
 		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
 		return
 	}
 
-	s.Tokens.Delete(t.Token)
+	s.denyTokens(*t)
+	s.Tokens.Delete(token)
+	if u, err := s.Users.GetById(t.UserID); err == nil {
+		s.recordEvent(ctx, u.ID, u.Email, types.EventLogout, "")
+	}
 	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
 }
 
 type settingsPassword struct {
-	OldPassword string `json:"old_password"`
-	NewPassword string `json:"new_password"`
+	OldPassword         string `json:"old_password"`
+	NewPassword         string `json:"new_password"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions,omitempty"`
 }
 
 func (s *Server) ChangePassword(ctx *fasthttp.RequestCtx) {
@@ -120,48 +279,72 @@ func (s *Server) ChangePassword(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	if !checkPasswordHash(sp.OldPassword, u.Password) {
+	keys := s.attemptKeys(ctx, u.Email)
+	if !s.checkLockout(ctx, keys) {
+		if lockedOut(ctx) {
+			s.recordEvent(ctx, u.ID, u.Email, types.EventPasswordChange, TooManyAttempts)
+		}
+		return
+	}
+
+	if !s.checkPassword(sp.OldPassword, u.Password) {
+		s.failAttempt(keys)
+		s.recordEvent(ctx, u.ID, u.Email, types.EventPasswordChange, InvalidCredentials)
 		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidCredentials)
 		return
 	}
 
-	if checkPasswordHash(sp.NewPassword, u.Password) {
+	if s.checkPassword(sp.NewPassword, u.Password) {
 		errorResponse(ctx, fasthttp.StatusBadRequest, "", PasswordEquals)
 		return
 	}
 
-	passRegexp := regexp.MustCompile(`^.{6,}$`)
-	if !passRegexp.MatchString(sp.NewPassword) {
-		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidPassword)
+	if !s.checkPasswordPolicy(ctx, sp.NewPassword, u.Email) {
 		return
 	}
 
-	hashPass, _ := hashPassword(sp.NewPassword)
+	hashPass, err := s.Hasher.Hash(sp.NewPassword)
+	if err != nil {
+		log.Println("password hash error: ", err)
+		errorResponse(ctx, fasthttp.StatusInternalServerError, "password hash error", "")
+		return
+	}
 	err = s.Users.EditPassword(u.ID, hashPass)
 	if err != nil {
 		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
 		return
 	}
 
-	okResponse(ctx, fasthttp.StatusCreated, map[string]string{})
-}
+	if sp.RevokeOtherSessions {
+		t, err := s.Tokens.GetByToken(ctx.UserValue("token").(string))
+		if err == nil {
+			_, err = s.revokeOtherSessions(u.ID, t.ID)
+		}
+		if err != nil {
+			errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+			return
+		}
+	}
+	s.recordEvent(ctx, u.ID, u.Email, types.EventPasswordChange, "")
 
-func hashPassword(password string) ([]byte, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-	return bytes, err
+	okResponse(ctx, fasthttp.StatusCreated, map[string]string{})
 }
 
-func checkPasswordHash(password string, hash []byte) bool {
-	err := bcrypt.CompareHashAndPassword(hash, []byte(password))
-	return err == nil
+// checkPassword reports whether password matches hash. A hash that cannot be
+// read is logged and counts as a mismatch.
+func (s *Server) checkPassword(password string, hash []byte) bool {
+	match, _, err := s.Hasher.Verify(password, hash)
+	if err != nil {
+		log.Println("password hash error: ", err)
+	}
+	return match
 }
 
-// https://stackoverflow.com/a/31832326/21711976
-func generateRandomToken(length int) string {
-	var letterRunes = []rune("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ_")
-	b := make([]rune, length)
-	for i := range b {
-		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+// generateRandomToken returns 256 bits from crypto/rand encoded as URL-safe base64.
+func generateRandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return string(b)
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
@@ -3,10 +3,15 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"reflect"
 	"strings"
+	"time"
 
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/iwajezhgf/todo-backend/storage"
 	"github.com/iwajezhgf/todo-backend/types"
 	"github.com/valyala/fasthttp"
 )
@@ -20,6 +25,33 @@ const (
 	Unauthorized       = "unauthorized"
 	NotFound           = "not_found"
 	PasswordEquals     = "password_equals"
+	RefreshTokenReused = "refresh_token_reused"
+	InvalidScope       = "invalid_scope"
+	InsufficientScope  = "insufficient_scope"
+	InvalidCode        = "invalid_code"
+	InvalidChallenge   = "invalid_challenge"
+	TwoFactorEnabled   = "two_factor_enabled"
+	TwoFactorDisabled  = "two_factor_disabled"
+	TooManyAttempts    = "too_many_attempts"
+	InvalidToken       = "invalid_token"
+	AlreadyVerified    = "already_verified"
+	EmailNotVerified   = "email_not_verified"
+	EmailEquals        = "email_equals"
+
+	PasswordTooShort      = "password_too_short"
+	PasswordTooLong       = "password_too_long"
+	PasswordTooWeak       = "password_too_weak"
+	PasswordContainsEmail = "password_contains_email"
+	PasswordBreached      = "password_breached"
+
+	InvalidDisplayName = "invalid_display_name"
+	InvalidTimeZone    = "invalid_time_zone"
+	InvalidLocale      = "invalid_locale"
+	InvalidWeekStart   = "invalid_week_start"
+	InvalidAvatarURL   = "invalid_avatar_url"
+
+	Forbidden       = "forbidden"
+	AccountDisabled = "account_disabled"
 )
 
 func okResponse(ctx *fasthttp.RequestCtx, code int, response interface{}) {
@@ -60,14 +92,94 @@ func errorResponse(ctx *fasthttp.RequestCtx, statusCode int, errorMessage string
 	ctx.SetBody(responseBytes)
 }
 
+var (
+	errTokenExpired    = errors.New("token expired")
+	errAccountDisabled = errors.New("account disabled")
+)
+
+// getUserByToken returns the user of the request. The user is kept in ctx, so
+// middleware and the handler after it share one lookup.
 func (s *Server) getUserByToken(ctx *fasthttp.RequestCtx) (*types.User, error) {
+	if u, ok := ctx.UserValue("user").(*types.User); ok {
+		return u, nil
+	}
+
+	u, err := s.lookupUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctx.SetUserValue("user", u)
+
+	return u, nil
+}
+
+func (s *Server) lookupUser(ctx *fasthttp.RequestCtx) (*types.User, error) {
+	// JWTs and personal access tokens are verified by onlyAuthorized and need
+	// no session lookup, but the user is still loaded so that disabling the
+	// account takes effect before the token expires.
+	if userId, ok := ctx.UserValue("user_id").(uint64); ok {
+		return s.activeUser(userId)
+	}
+
 	token := ctx.UserValue("token").(string)
 	t, err := s.Tokens.GetByToken(token)
 	if err != nil {
 		return nil, err
 	}
 
-	return s.Users.GetById(t.UserID)
+	now := time.Now().UTC()
+	if !now.Before(t.Expire) {
+		return nil, errTokenExpired
+	}
+
+	if now.Sub(t.LastUsed) >= s.Auth.RenewInterval {
+		// Access tokens of refresh sessions are only renewed by a refresh.
+		expire := t.Expire
+		if t.SessionExpire == nil {
+			expire = s.Auth.tokenExpire(t.Created, now)
+		}
+		// A failed renewal only shortens the session, so the request goes on.
+		_ = s.Tokens.Touch(t.ID, now, expire)
+	}
+
+	return s.activeUser(t.UserID)
+}
+
+// activeUser returns the user unless their account is disabled.
+func (s *Server) activeUser(id uint64) (*types.User, error) {
+	u, err := s.Users.GetById(id)
+	if err != nil {
+		return nil, err
+	}
+	if u.DisabledAt != nil {
+		return nil, errAccountDisabled
+	}
+
+	return u, nil
+}
+
+// sendMail sends msg and logs when that fails. It is meant to run in its own
+// goroutine, so slow mail servers do not hold up responses.
+func (s *Server) sendMail(msg mail.Message) {
+	if err := s.Mailer.Send(msg); err != nil {
+		log.Println("mail error: ", err)
+	}
+}
+
+// clientInfo returns the user agent and IP address of the request, trimmed to
+// fit the session columns of the tokens table.
+func clientInfo(ctx *fasthttp.RequestCtx) (userAgent, ip string) {
+	// Events from the admin commands have no request.
+	if ctx == nil {
+		return "", ""
+	}
+
+	userAgent = string(ctx.UserAgent())
+	if len(userAgent) > 512 {
+		userAgent = userAgent[:512]
+	}
+
+	return userAgent, ctx.RemoteIP().String()
 }
 
 func (s *Server) validateFields(entity interface{}) func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
@@ -88,7 +200,10 @@ func (s *Server) validateFields(entity interface{}) func(next fasthttp.RequestHa
 
 			for i := 0; i < entityType.NumField(); i++ {
 				field := entityType.Field(i)
-				fieldName := strings.ToLower(field.Tag.Get("json"))
+				fieldName, options, _ := strings.Cut(strings.ToLower(field.Tag.Get("json")), ",")
+				if options == "omitempty" {
+					continue
+				}
 				if value, ok := data[fieldName]; !ok || fmt.Sprintf("%v", value) == "" {
 					errorResponse(ctx, fasthttp.StatusBadRequest, fmt.Sprintf("Invalid %s", fieldName), "")
 					return
@@ -100,22 +215,72 @@ func (s *Server) validateFields(entity interface{}) func(next fasthttp.RequestHa
 	}
 }
 
-func (s *Server) onlyAuthorized(next fasthttp.RequestHandler) fasthttp.RequestHandler {
-	return func(ctx *fasthttp.RequestCtx) {
-		authHeader := ctx.Request.Header.Peek("Authorization")
-		if authHeader == nil {
-			errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
-			return
-		}
+// onlyAuthorized lets through requests with a session token, or with a
+// personal access token that was granted scope.
+func (s *Server) onlyAuthorized(scope string) func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			authHeader := ctx.Request.Header.Peek("Authorization")
+			if authHeader == nil {
+				errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+				return
+			}
 
-		const bearer = "Bearer "
-		if !bytes.HasPrefix(authHeader, []byte(bearer)) {
-			errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
-			return
-		}
+			const bearer = "Bearer "
+			if !bytes.HasPrefix(authHeader, []byte(bearer)) {
+				errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+				return
+			}
 
-		token := string(authHeader[len(bearer):])
-		ctx.SetUserValue("token", token)
-		next(ctx)
+			// Session tokens are random and can start with one of the
+			// prefixes by chance, so a prefixed token that is not found
+			// is still looked up as a session.
+			token := string(authHeader[len(bearer):])
+			if isImpersonationToken(token) {
+				imp, err := s.Impersonations.GetByToken(token)
+				if err == nil {
+					if s.authorizeImpersonation(ctx, imp, scope) {
+						ctx.SetUserValue("token", token)
+						next(ctx)
+						s.recordImpersonation(imp, imp.AdminID, types.AuditRequest, ctx)
+					}
+					return
+				}
+				if !errors.Is(err, storage.ErrNotFound) {
+					errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+					return
+				}
+			}
+			if isPersonalToken(token) {
+				pat, err := s.PersonalTokens.GetByToken(token)
+				if err == nil {
+					if s.authorizePersonalToken(ctx, pat, scope) {
+						ctx.SetUserValue("token", token)
+						next(ctx)
+					}
+					return
+				}
+				if !errors.Is(err, storage.ErrNotFound) {
+					errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+					return
+				}
+			}
+
+			if s.jwt != nil {
+				userId, jti, expire, err := s.jwt.parse(token)
+				if err != nil || s.denylist.has(storage.HashToken(jti)) {
+					errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+					return
+				}
+
+				// Sessions of JWTs are stored under their jti.
+				token = jti
+				ctx.SetUserValue("user_id", userId)
+				ctx.SetUserValue("token_expire", expire)
+			}
+
+			ctx.SetUserValue("token", token)
+			next(ctx)
+		}
 	}
 }
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/iwajezhgf/todo-backend/types"
+	"github.com/valyala/fasthttp"
+)
+
+// What users with an unverified email address may do.
+const (
+	UnverifiedFull     = "full"
+	UnverifiedReadOnly = "read_only"
+)
+
+// VerificationConfig controls the links that confirm email addresses.
+type VerificationConfig struct {
+	// Secret is the base64 key links are signed with. Without one a random
+	// key is used, and links stop working when the server restarts.
+	Secret   string
+	Lifetime time.Duration
+	// UnverifiedAccess is UnverifiedFull (the default) or UnverifiedReadOnly.
+	UnverifiedAccess string
+}
+
+var errInvalidVerification = errors.New("invalid verification token")
+
+func newVerificationKey(secret string) ([]byte, error) {
+	if secret == "" {
+		log.Println("auth.verification.secret is not set, verification links will not survive a restart")
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification secret: %w", err)
+	}
+	if len(key) < 32 {
+		return nil, errors.New("verification secret must be at least 32 bytes")
+	}
+
+	return key, nil
+}
+
+// verificationToken signs the user's current email address, so the link stops
+// working once the address changes.
+func (s *Server) verificationToken(u *types.User, expire time.Time) string {
+	payload := fmt.Sprintf("%d:%d:%s", u.ID, expire.Unix(), strings.ToLower(u.Email))
+
+	mac := hmac.New(sha256.New, s.verifyKey)
+	mac.Write([]byte(payload))
+
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseVerificationToken returns the user a valid, unexpired token was issued
+// to and the email address it confirms.
+func (s *Server) parseVerificationToken(token string) (uint64, string, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", errInvalidVerification
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, "", errInvalidVerification
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return 0, "", errInvalidVerification
+	}
+
+	mac := hmac.New(sha256.New, s.verifyKey)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return 0, "", errInvalidVerification
+	}
+
+	parts := strings.SplitN(string(payload), ":", 3)
+	if len(parts) != 3 {
+		return 0, "", errInvalidVerification
+	}
+	userId, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, "", errInvalidVerification
+	}
+	expire, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expire {
+		return 0, "", errInvalidVerification
+	}
+
+	return userId, parts[2], nil
+}
+
+// sendVerification mails the user a link to confirm their email address.
+func (s *Server) sendVerification(u *types.User) {
+	expire := time.Now().UTC().Add(s.Auth.Verification.Lifetime)
+	link := s.PublicURL + "/verify-email?token=" + url.QueryEscape(s.verificationToken(u, expire))
+
+	go s.sendMail(mail.Message{
+		To:      u.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf(
+			"Please confirm that this is your email address by opening\n\n%s\n\n"+
+				"The link is valid for %.0f hours. If you did not sign up, ignore this email.",
+			link, s.Auth.Verification.Lifetime.Hours(),
+		),
+	})
+}
+
+type verifyEmail struct {
+	Token string `json:"token"`
+}
+
+func (s *Server) handleVerify(ctx *fasthttp.RequestCtx) {
+	var ve verifyEmail
+	json.Unmarshal(ctx.PostBody(), &ve)
+
+	userId, email, err := s.parseVerificationToken(ve.Token)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return
+	}
+
+	u, err := s.Users.GetById(userId)
+	if err != nil || !strings.EqualFold(u.Email, email) {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", InvalidToken)
+		return
+	}
+
+	err = s.Users.Verify(u.ID, time.Now().UTC())
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusInternalServerError, err.Error(), "")
+		return
+	}
+
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+func (s *Server) handleResendVerification(ctx *fasthttp.RequestCtx) {
+	u, err := s.getUserByToken(ctx)
+	if err != nil {
+		errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+		return
+	}
+
+	if u.VerifiedAt != nil {
+		errorResponse(ctx, fasthttp.StatusBadRequest, "", AlreadyVerified)
+		return
+	}
+
+	// Every mail counts, so the route cannot be used to flood an inbox.
+	keys := s.resendKeys(ctx, u.ID)
+	if !s.checkLockout(ctx, keys) {
+		return
+	}
+	s.failAttempt(keys)
+
+	s.sendVerification(u)
+	okResponse(ctx, fasthttp.StatusOK, map[string]string{})
+}
+
+// onlyVerified keeps users with an unverified email address from the routes
+// it wraps when UnverifiedAccess is read-only.
+func (s *Server) onlyVerified(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if s.Auth.Verification.UnverifiedAccess == UnverifiedReadOnly {
+			u, err := s.getUserByToken(ctx)
+			if err != nil {
+				errorResponse(ctx, fasthttp.StatusUnauthorized, "Unauthorized", Unauthorized)
+				return
+			}
+			if u.VerifiedAt == nil {
+				errorResponse(ctx, fasthttp.StatusForbidden, "Email address is not verified", EmailNotVerified)
+				return
+			}
+		}
+
+		next(ctx)
+	}
+}
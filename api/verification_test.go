@@ -0,0 +1,87 @@
+package api
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+func TestUnverifiedReadOnly(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		s.Auth.Verification.UnverifiedAccess = UnverifiedReadOnly
+	})
+	_, token := ts.createUser(t, "ann@example.com", "", false)
+	other, _ := ts.createUser(t, "bob@example.com", "", true)
+	_, adminToken := ts.createUser(t, "admin@example.com", types.RoleAdmin, false)
+
+	blocked := []struct {
+		name, method, path, token string
+		body                      interface{}
+	}{
+		{"profile", "PATCH", "/api/profile", token, map[string]string{"display_name": "Ann"}},
+		{"password", "POST", "/api/settings/password", token, map[string]string{"old_password": testPassword, "new_password": "n3w Passw0rd!"}},
+		{"email", "POST", "/api/settings/email", token, map[string]string{"password": testPassword, "email": "new@example.com"}},
+		{"account delete", "DELETE", "/api/account", token, map[string]string{"password": testPassword}},
+		{"account restore", "POST", "/api/account/restore", token, nil},
+		{"session rename", "PUT", "/api/sessions/1", token, map[string]string{"name": "laptop"}},
+		{"session delete", "DELETE", "/api/sessions/1", token, nil},
+		{"other sessions", "POST", "/api/sessions/revoke-others", token, nil},
+		{"2fa enroll", "POST", "/api/2fa/enroll", token, nil},
+		{"2fa confirm", "POST", "/api/2fa/confirm", token, map[string]string{"code": "123456"}},
+		{"2fa disable", "POST", "/api/2fa/disable", token, map[string]string{"password": testPassword, "code": "123456"}},
+		{"token create", "POST", "/api/tokens", token, map[string]interface{}{"name": "ci", "scopes": []string{ScopeTodosRead}}},
+		{"token delete", "DELETE", "/api/tokens/1", token, nil},
+		{"todo create", "POST", "/api/todo", token, map[string]string{"title": "t", "note": "n", "expire": "2030-01-01T00:00:00Z"}},
+		{"admin", "POST", "/api/admin/users/" + strconv.FormatUint(other.ID, 10) + "/logout", adminToken, nil},
+	}
+	for _, tt := range blocked {
+		t.Run(tt.name, func(t *testing.T) {
+			r := ts.do(t, tt.method, tt.path, tt.token, tt.body)
+			if r.status != 403 || r.code != EmailNotVerified {
+				t.Errorf("%s %s = %d %s, want 403 %s", tt.method, tt.path, r.status, r.body, EmailNotVerified)
+			}
+		})
+	}
+
+	allowed := []struct {
+		name, method, path string
+	}{
+		{"profile", "GET", "/api/profile"},
+		{"sessions", "GET", "/api/sessions"},
+		{"resend", "POST", "/api/verify/resend"},
+		{"logout", "POST", "/api/logout"},
+	}
+	for _, tt := range allowed {
+		t.Run(tt.name, func(t *testing.T) {
+			if r := ts.do(t, tt.method, tt.path, token, nil); r.status != 200 {
+				t.Errorf("%s %s = %d %s, want 200", tt.method, tt.path, r.status, r.body)
+			}
+		})
+	}
+}
+
+func TestVerifiedUserCanWrite(t *testing.T) {
+	ts := newTestServer(t, func(s *Server) {
+		s.Auth.Verification.UnverifiedAccess = UnverifiedReadOnly
+	})
+	_, token := ts.createUser(t, "ann@example.com", "", true)
+
+	if r := ts.do(t, "PATCH", "/api/profile", token, map[string]string{"display_name": "Ann"}); r.status != 200 {
+		t.Errorf("PATCH /api/profile = %d %s, want 200", r.status, r.body)
+	}
+}
+
+func TestResendVerificationLimit(t *testing.T) {
+	ts := newTestServer(t, nil)
+	_, token := ts.createUser(t, "ann@example.com", "", false)
+
+	for i := 0; i < ts.Auth.Lockout.ResendUserThreshold; i++ {
+		if r := ts.do(t, "POST", "/api/verify/resend", token, nil); r.status != 200 {
+			t.Fatalf("resend %d = %d %s, want 200", i+1, r.status, r.body)
+		}
+	}
+	if r := ts.do(t, "POST", "/api/verify/resend", token, nil); r.status != 429 || r.code != TooManyAttempts {
+		t.Errorf("resend over the limit = %d %s, want 429 %s", r.status, r.body, TooManyAttempts)
+	}
+}
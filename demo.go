@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/hasher"
+	"github.com/iwajezhgf/todo-backend/storage"
+)
+
+const (
+	demoEmail    = "demo@example.com"
+	demoPassword = "Explore-todos-42"
+)
+
+// seedDemo fills a fresh store with a demo account and a few todos in
+// every status, so the API can be explored without a database.
+func seedDemo(users storage.UserStore, todos storage.TodoStore, h *hasher.Hasher) error {
+	hashedPassword, err := h.Hash(demoPassword)
+	if err != nil {
+		return err
+	}
+
+	if err = users.Create(demoEmail, hashedPassword); err != nil {
+		return err
+	}
+
+	u, err := users.GetByEmail(demoEmail)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if err = users.Verify(u.ID, now); err != nil {
+		return err
+	}
+
+	demoTodos := []struct {
+		title, note string
+		expire      time.Time
+	}{
+		{"Buy groceries", "Milk, bread, eggs", now.Add(24 * time.Hour)},
+		{"Finish report", "Quarterly numbers for the team", now.Add(72 * time.Hour)},
+		{"Call the dentist", "Reschedule the appointment", now.Add(-2 * time.Hour)},
+		{"Read a book", "Any novel will do", now.Add(7 * 24 * time.Hour)},
+	}
+	for _, t := range demoTodos {
+		if err = todos.Create(t.title, t.note, t.expire, u.ID); err != nil {
+			return err
+		}
+	}
+
+	data, err := todos.GetTodosByPage(u.ID, 1, len(demoTodos))
+	if err != nil {
+		return err
+	}
+	if len(data.Items) > 0 {
+		last := data.Items[len(data.Items)-1]
+		if err = todos.EditStatus(last.ID, u.ID, "completed"); err != nil {
+			return err
+		}
+	}
+	todos.CheckTodoStatus()
+
+	log.Printf("demo mode: log in as %s with password %s", demoEmail, demoPassword)
+
+	return nil
+}
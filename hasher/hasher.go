@@ -0,0 +1,143 @@
+// Package hasher hashes passwords with argon2id or bcrypt and verifies hashes
+// made with either, so the algorithm and its parameters can change without
+// invalidating stored passwords.
+package hasher
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var ErrUnknownHash = errors.New("unknown password hash format")
+
+type Argon2Params struct {
+	// Memory is in KiB.
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+type Config struct {
+	// Algorithm new hashes are made with, Argon2id or Bcrypt.
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+type Hasher struct {
+	c Config
+}
+
+func New(c Config) (*Hasher, error) {
+	switch c.Algorithm {
+	case Argon2id:
+		p := c.Argon2
+		if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 || p.SaltLength < 8 || p.KeyLength < 16 {
+			return nil, errors.New("invalid argon2id parameters")
+		}
+	case Bcrypt:
+		if c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported password hash algorithm %q", c.Algorithm)
+	}
+
+	return &Hasher{c: c}, nil
+}
+
+// Hash returns the encoded hash of password in PHC string format, or in the
+// modular crypt format bcrypt has always used.
+func (h *Hasher) Hash(password string) ([]byte, error) {
+	if h.c.Algorithm == Bcrypt {
+		return bcrypt.GenerateFromPassword([]byte(password), h.c.BcryptCost)
+	}
+
+	p := h.c.Argon2
+	salt := make([]byte, p.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	encoded := fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return []byte(encoded), nil
+}
+
+// Verify reports whether password matches the encoded hash, and whether the
+// hash should be replaced because it was made with other settings than the
+// current ones.
+func (h *Hasher) Verify(password string, encoded []byte) (match, rehash bool, err error) {
+	if strings.HasPrefix(string(encoded), "$argon2id$") {
+		return h.verifyArgon2id(password, string(encoded))
+	}
+
+	if cost, costErr := bcrypt.Cost(encoded); costErr == nil {
+		err = bcrypt.CompareHashAndPassword(encoded, []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, false, nil
+		}
+		if err != nil {
+			return false, false, err
+		}
+		return true, h.c.Algorithm != Bcrypt || cost != h.c.BcryptCost, nil
+	}
+
+	return false, false, ErrUnknownHash
+}
+
+func (h *Hasher) verifyArgon2id(password, encoded string) (bool, bool, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, ErrUnknownHash
+	}
+
+	var p Argon2Params
+	// argon2.IDKey panics on zero rounds or threads.
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil ||
+		p.Iterations == 0 || p.Parallelism == 0 {
+		return false, false, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, false, ErrUnknownHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	other := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	return true, h.c.Algorithm != Argon2id || p != h.c.Argon2, nil
+}
@@ -0,0 +1,147 @@
+package hasher
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 is cheap enough to hash with in tests.
+var testArgon2 = Argon2Params{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func newHasher(t *testing.T, c Config) *Hasher {
+	t.Helper()
+
+	h, err := New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestArgon2idRoundTrip(t *testing.T) {
+	h := newHasher(t, Config{Algorithm: Argon2id, Argon2: testArgon2})
+
+	encoded, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := fmt.Sprintf("$argon2id$v=%d$m=64,t=1,p=1$", argon2.Version)
+	if !strings.HasPrefix(string(encoded), prefix) {
+		t.Errorf("Hash = %s, want the prefix %s", encoded, prefix)
+	}
+
+	if match, rehash, err := h.Verify("correct horse", encoded); !match || rehash || err != nil {
+		t.Errorf("Verify = %t, %t, %v, want true, false, nil", match, rehash, err)
+	}
+	if match, _, err := h.Verify("wrong horse", encoded); match || err != nil {
+		t.Errorf("Verify of another password = %t, %v, want false, nil", match, err)
+	}
+}
+
+func TestArgon2idDecode(t *testing.T) {
+	// A hash put together by hand rather than by Hash, so that decoding does
+	// not just mirror the encoder.
+	salt := []byte("somesaltsomesalt")
+	key := argon2.IDKey([]byte("password"), salt, 2, 32, 2, 24)
+	encoded := "$argon2id$v=19$m=32,t=2,p=2$" +
+		base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(key)
+
+	h := newHasher(t, Config{Algorithm: Argon2id, Argon2: testArgon2})
+	if match, rehash, err := h.Verify("password", []byte(encoded)); !match || !rehash || err != nil {
+		t.Errorf("Verify = %t, %t, %v, want true, true, nil", match, rehash, err)
+	}
+
+	same := newHasher(t, Config{Algorithm: Argon2id, Argon2: Argon2Params{
+		Memory: 32, Iterations: 2, Parallelism: 2, SaltLength: 16, KeyLength: 24,
+	}})
+	if match, rehash, err := same.Verify("password", []byte(encoded)); !match || rehash || err != nil {
+		t.Errorf("Verify with the hash's parameters = %t, %t, %v, want true, false, nil", match, rehash, err)
+	}
+}
+
+func TestVerifyRehash(t *testing.T) {
+	argon := newHasher(t, Config{Algorithm: Argon2id, Argon2: testArgon2})
+	weaker := newHasher(t, Config{Algorithm: Argon2id, Argon2: Argon2Params{
+		Memory: 32, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32,
+	}})
+	bcryptMin := newHasher(t, Config{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost})
+	bcryptMore := newHasher(t, Config{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost + 1})
+
+	hash := func(h *Hasher) []byte {
+		encoded, err := h.Hash("correct horse")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encoded
+	}
+
+	tests := []struct {
+		name   string
+		h      *Hasher
+		hash   []byte
+		rehash bool
+	}{
+		{"bcrypt hash with argon2id", argon, hash(bcryptMin), true},
+		{"bcrypt hash with a higher cost", bcryptMore, hash(bcryptMin), true},
+		{"bcrypt hash with the same cost", bcryptMin, hash(bcryptMin), false},
+		{"weaker argon2id parameters", argon, hash(weaker), true},
+		{"argon2id hash with bcrypt", bcryptMin, hash(argon), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, rehash, err := tt.h.Verify("correct horse", tt.hash)
+			if !match || rehash != tt.rehash || err != nil {
+				t.Errorf("Verify = %t, %t, %v, want true, %t, nil", match, rehash, err, tt.rehash)
+			}
+		})
+	}
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	h := newHasher(t, Config{Algorithm: Argon2id, Argon2: testArgon2})
+	valid, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(string(valid), "$")
+	join := func(change func(parts []string)) string {
+		p := append([]string(nil), parts...)
+		change(p)
+		return strings.Join(p, "$")
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{"empty", ""},
+		{"plain text", "correct horse"},
+		{"prefix only", "$argon2id$"},
+		{"no key", strings.Join(parts[:5], "$")},
+		{"truncated", string(valid[:len(valid)/2])},
+		{"extra part", string(valid) + "$x"},
+		{"other version", join(func(p []string) { p[2] = "v=16" })},
+		{"no version", join(func(p []string) { p[2] = "" })},
+		{"no parameters", join(func(p []string) { p[3] = "" })},
+		{"zero iterations", join(func(p []string) { p[3] = "m=64,t=0,p=1" })},
+		{"zero parallelism", join(func(p []string) { p[3] = "m=64,t=1,p=0" })},
+		{"parallelism out of range", join(func(p []string) { p[3] = "m=64,t=1,p=256" })},
+		{"bad salt", join(func(p []string) { p[4] = "!!" })},
+		{"bad key", join(func(p []string) { p[5] = "!!" })},
+		{"empty key", join(func(p []string) { p[5] = "" })},
+		{"truncated bcrypt", "$2a$04$abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			match, _, err := h.Verify("correct horse", []byte(tt.encoded))
+			if match || err == nil {
+				t.Errorf("Verify(%q) = %t, %v, want an error", tt.encoded, match, err)
+			}
+		})
+	}
+}
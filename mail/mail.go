@@ -0,0 +1,53 @@
+// Package mail sends the emails of the account flows.
+package mail
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Config selects and configures a Mailer.
+type Config struct {
+	// Driver is "smtp" or "file".
+	Driver string
+	From   string
+	// FilePath is where the file mailer appends messages. When empty they
+	// are written to the log.
+	FilePath string
+
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUser     string
+	SMTPPassword string
+}
+
+func New(c Config) (Mailer, error) {
+	switch c.Driver {
+	case "smtp":
+		if c.SMTPHost == "" {
+			return nil, errors.New("mail.smtp.host is required")
+		}
+		return &SMTPMailer{
+			Host:     c.SMTPHost,
+			Port:     c.SMTPPort,
+			User:     c.SMTPUser,
+			Password: c.SMTPPassword,
+			From:     c.From,
+		}, nil
+	case "file", "":
+		return &FileMailer{Path: c.FilePath, From: c.From}, nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver %q", c.Driver)
+	}
+}
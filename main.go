@@ -1,63 +1,482 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/iwajezhgf/todo-backend/api"
+	"github.com/iwajezhgf/todo-backend/hasher"
+	"github.com/iwajezhgf/todo-backend/mail"
+	"github.com/iwajezhgf/todo-backend/passwords"
+	"github.com/iwajezhgf/todo-backend/schemas"
 	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/storage/memory"
+	"github.com/iwajezhgf/todo-backend/storage/sqldb"
 	"github.com/spf13/viper"
 )
 
 type config struct {
 	DB     dbConfig     `yaml:"db"`
 	Server serverConfig `yaml:"server"`
+	Auth   authConfig   `yaml:"auth"`
+	Mail   mailConfig   `yaml:"mail"`
 }
 
 type dbConfig struct {
+	Driver      string `yaml:"driver"`
+	Host        string `yaml:"host"`
+	Database    string `yaml:"database"`
+	User        string `yaml:"user"`
+	Password    string `yaml:"password"`
+	SSLMode     string `yaml:"sslmode"`
+	AutoMigrate bool   `yaml:"auto_migrate" mapstructure:"auto_migrate"`
+}
+
+type serverConfig struct {
+	Host      string `yaml:"host"`
+	Port      uint16 `yaml:"port"`
+	PublicURL string `yaml:"public_url" mapstructure:"public_url"`
+}
+
+type authConfig struct {
+	TokenLifetime    time.Duration `yaml:"token_lifetime" mapstructure:"token_lifetime"`
+	Sliding          bool          `yaml:"sliding"`
+	RenewInterval    time.Duration `yaml:"renew_interval" mapstructure:"renew_interval"`
+	AbsoluteLifetime time.Duration `yaml:"absolute_lifetime" mapstructure:"absolute_lifetime"`
+	IdleTimeout      time.Duration `yaml:"idle_timeout" mapstructure:"idle_timeout"`
+
+	AccessTokenLifetime time.Duration `yaml:"access_token_lifetime" mapstructure:"access_token_lifetime"`
+
+	Mode    string        `yaml:"mode"`
+	JWT     jwtConfig     `yaml:"jwt"`
+	TOTP    totpConfig    `yaml:"totp"`
+	Lockout lockoutConfig `yaml:"lockout"`
+
+	PasswordResetLifetime time.Duration `yaml:"password_reset_lifetime" mapstructure:"password_reset_lifetime"`
+
+	Verification verificationConfig `yaml:"verification"`
+	EmailChange  emailChangeConfig  `yaml:"email_change" mapstructure:"email_change"`
+
+	DeletionGracePeriod time.Duration `yaml:"deletion_grace_period" mapstructure:"deletion_grace_period"`
+
+	ImpersonationLifetime time.Duration `yaml:"impersonation_lifetime" mapstructure:"impersonation_lifetime"`
+
+	EventRetention time.Duration `yaml:"event_retention" mapstructure:"event_retention"`
+
+	Password passwordConfig `yaml:"password"`
+}
+
+type jwtConfig struct {
+	Algorithm string   `yaml:"algorithm"`
+	Issuer    string   `yaml:"issuer"`
+	ActiveKID string   `yaml:"active_kid" mapstructure:"active_kid"`
+	Keys      []jwtKey `yaml:"keys"`
+}
+
+type jwtKey struct {
+	KID string `yaml:"kid"`
+	Key string `yaml:"key"`
+}
+
+type lockoutConfig struct {
+	AccountThreshold    int           `yaml:"account_threshold" mapstructure:"account_threshold"`
+	IPThreshold         int           `yaml:"ip_threshold" mapstructure:"ip_threshold"`
+	ResetEmailThreshold int           `yaml:"reset_email_threshold" mapstructure:"reset_email_threshold"`
+	ResetIPThreshold    int           `yaml:"reset_ip_threshold" mapstructure:"reset_ip_threshold"`
+	ResendUserThreshold int           `yaml:"resend_user_threshold" mapstructure:"resend_user_threshold"`
+	ResendIPThreshold   int           `yaml:"resend_ip_threshold" mapstructure:"resend_ip_threshold"`
+	BaseDelay           time.Duration `yaml:"base_delay" mapstructure:"base_delay"`
+	MaxDelay            time.Duration `yaml:"max_delay" mapstructure:"max_delay"`
+	Window              time.Duration `yaml:"window"`
+}
+
+type verificationConfig struct {
+	UnverifiedAccess string        `yaml:"unverified_access" mapstructure:"unverified_access"`
+	Lifetime         time.Duration `yaml:"lifetime"`
+	Secret           string        `yaml:"secret"`
+}
+
+type emailChangeConfig struct {
+	ConfirmLifetime time.Duration `yaml:"confirm_lifetime" mapstructure:"confirm_lifetime"`
+	RevertLifetime  time.Duration `yaml:"revert_lifetime" mapstructure:"revert_lifetime"`
+}
+
+type passwordConfig struct {
+	Algorithm  string       `yaml:"algorithm"`
+	Argon2     argon2Config `yaml:"argon2"`
+	BcryptCost int          `yaml:"bcrypt_cost" mapstructure:"bcrypt_cost"`
+
+	MinLength   int     `yaml:"min_length" mapstructure:"min_length"`
+	MaxLength   int     `yaml:"max_length" mapstructure:"max_length"`
+	MinEntropy  float64 `yaml:"min_entropy" mapstructure:"min_entropy"`
+	CheckCommon bool    `yaml:"check_common" mapstructure:"check_common"`
+	CommonList  string  `yaml:"common_list" mapstructure:"common_list"`
+}
+
+type argon2Config struct {
+	Memory      uint32 `yaml:"memory"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"salt_length" mapstructure:"salt_length"`
+	KeyLength   uint32 `yaml:"key_length" mapstructure:"key_length"`
+}
+
+type mailConfig struct {
+	Driver   string     `yaml:"driver"`
+	From     string     `yaml:"from"`
+	FilePath string     `yaml:"file_path" mapstructure:"file_path"`
+	SMTP     smtpConfig `yaml:"smtp"`
+}
+
+type smtpConfig struct {
 	Host     string `yaml:"host"`
-	Database string `yaml:"database"`
+	Port     int    `yaml:"port"`
 	User     string `yaml:"user"`
 	Password string `yaml:"password"`
 }
 
-type serverConfig struct {
-	Host string `yaml:"host"`
-	Port uint16 `yaml:"port"`
+type totpConfig struct {
+	Issuer            string        `yaml:"issuer"`
+	ChallengeLifetime time.Duration `yaml:"challenge_lifetime" mapstructure:"challenge_lifetime"`
 }
 
 func main() {
+	demo := flag.Bool("demo", false, "run on an in-memory database seeded with demo data")
+	flag.Usage = usage
+	flag.Parse()
+
 	var c config
 	if err := initConfig("config.yml", &c); err != nil {
 		log.Fatalf("failed to load config file: %s", err)
 	}
 
-	db, err := storage.NewStorage(c.DB.Host, c.DB.Database, c.DB.User, c.DB.Password)
+	var err error
+	switch cmd := flag.Arg(0); cmd {
+	case "", "serve":
+		err = serve(c, *demo)
+	case "migrate":
+		err = runMigrate(c, flag.Args()[1:])
+	case "user":
+		err = runUser(c, flag.Args()[1:])
+	case "token":
+		err = runToken(c, flag.Args()[1:])
+	case "todos":
+		err = runTodos(c, flag.Args()[1:])
+	default:
+		usage()
+		log.Fatalf("unknown command %q", cmd)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprint(flag.CommandLine.Output(), `Usage: todo-backend [--demo] [command]
+
+Without a command the API server is started.
+
+Commands:
+  serve                     start the API server
+  migrate up                apply all pending migrations
+  migrate down [N]          roll back the last N migrations (default 1)
+  migrate status            list migrations and whether they are applied
+  migrate baseline <version>
+                            mark migrations up to version as applied without running them
+  migrate create <name>     create empty migration files for every driver
+
+  user create --email <email> [--password <password>]
+  user reset-password --email <email> [--password <password>]
+  user set-role --email <email> --role user|support|admin
+  user delete --email <email>
+                            manage users; the password is read from stdin when omitted
+  token revoke --user <email>
+                            log the user out of every session
+  todos export --user <email>
+                            print the user's todos as JSON
+  todos recompute-status    mark todos overdue or active from their expire time
+
+Flags:
+`)
+	flag.PrintDefaults()
+}
+
+func serve(c config, demo bool) error {
+	h, err := newHasher(c.Auth.Password)
 	if err != nil {
-		log.Fatalf("db error: %s", err)
+		return err
 	}
 
-	todos := &storage.TodoStorage{Storage: db}
-	tokens := &storage.TokenStorage{Storage: db}
-	users := &storage.UserStorage{Storage: db}
+	var (
+		todos          storage.TodoStore
+		tokens         storage.TokenStore
+		personalTokens storage.PersonalTokenStore
+		twoFactor      storage.TwoFactorStore
+		attempts       storage.AttemptStore
+		passwordResets storage.PasswordResetStore
+		emailChanges   storage.EmailChangeStore
+		impersonations storage.ImpersonationStore
+		authEvents     storage.AuthEventStore
+		users          storage.UserStore
+	)
+	if demo {
+		mem := memory.NewStorage()
+		todos = &memory.TodoStorage{Storage: mem}
+		tokens = &memory.TokenStorage{Storage: mem}
+		personalTokens = &memory.PersonalTokenStorage{Storage: mem}
+		twoFactor = &memory.TwoFactorStorage{Storage: mem}
+		attempts = &memory.AttemptStorage{Storage: mem}
+		passwordResets = &memory.PasswordResetStorage{Storage: mem}
+		emailChanges = &memory.EmailChangeStorage{Storage: mem}
+		impersonations = &memory.ImpersonationStorage{Storage: mem}
+		authEvents = &memory.AuthEventStorage{Storage: mem}
+		users = &memory.UserStorage{Storage: mem}
 
-	go todos.StartTodoStatus()
-	go tokens.StartTokenCleanup()
+		if err := seedDemo(users, todos, h); err != nil {
+			return fmt.Errorf("failed to seed demo data: %w", err)
+		}
+	} else {
+		db, err := openDB(c.DB)
+		if err != nil {
+			return err
+		}
+
+		if c.DB.AutoMigrate {
+			if err = migrateUp(db); err != nil {
+				return err
+			}
+		}
+
+		todos = &sqldb.TodoStorage{Storage: db}
+		tokens = &sqldb.TokenStorage{Storage: db}
+		personalTokens = &sqldb.PersonalTokenStorage{Storage: db}
+		twoFactor = &sqldb.TwoFactorStorage{Storage: db}
+		attempts = &sqldb.AttemptStorage{Storage: db}
+		passwordResets = &sqldb.PasswordResetStorage{Storage: db}
+		emailChanges = &sqldb.EmailChangeStorage{Storage: db}
+		impersonations = &sqldb.ImpersonationStorage{Storage: db}
+		authEvents = &sqldb.AuthEventStorage{Storage: db}
+		users = &sqldb.UserStorage{Storage: db}
+	}
+
+	go storage.StartTodoStatus(todos)
+	go storage.StartAccountPurge(users)
+	go storage.StartTokenCleanup(tokens, personalTokens, twoFactor, attempts, passwordResets, emailChanges)
+	go storage.StartAuthEventRetention(authEvents, c.Auth.EventRetention)
+
+	mailer, err := mail.New(mail.Config{
+		Driver:       c.Mail.Driver,
+		From:         c.Mail.From,
+		FilePath:     c.Mail.FilePath,
+		SMTPHost:     c.Mail.SMTP.Host,
+		SMTPPort:     c.Mail.SMTP.Port,
+		SMTPUser:     c.Mail.SMTP.User,
+		SMTPPassword: c.Mail.SMTP.Password,
+	})
+	if err != nil {
+		return err
+	}
 
 	serverHost := fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 
+	policy, err := passwordPolicy(c.Auth.Password)
+	if err != nil {
+		return err
+	}
+
 	s := api.Server{
-		Todos:  todos,
-		Tokens: tokens,
-		Users:  users,
+		Todos:          todos,
+		Tokens:         tokens,
+		PersonalTokens: personalTokens,
+		TwoFactor:      twoFactor,
+		Attempts:       attempts,
+		PasswordResets: passwordResets,
+		EmailChanges:   emailChanges,
+		Impersonations: impersonations,
+		AuthEvents:     authEvents,
+		Users:          users,
+		Auth: api.AuthConfig{
+			TokenLifetime:    c.Auth.TokenLifetime,
+			Sliding:          c.Auth.Sliding,
+			RenewInterval:    c.Auth.RenewInterval,
+			AbsoluteLifetime: c.Auth.AbsoluteLifetime,
+			IdleTimeout:      c.Auth.IdleTimeout,
+
+			AccessTokenLifetime: c.Auth.AccessTokenLifetime,
+
+			Mode: c.Auth.Mode,
+			JWT:  apiJWTConfig(c.Auth.JWT),
+
+			TOTPIssuer:        c.Auth.TOTP.Issuer,
+			ChallengeLifetime: c.Auth.TOTP.ChallengeLifetime,
+
+			Lockout: api.LockoutConfig{
+				AccountThreshold:    c.Auth.Lockout.AccountThreshold,
+				IPThreshold:         c.Auth.Lockout.IPThreshold,
+				ResetEmailThreshold: c.Auth.Lockout.ResetEmailThreshold,
+				ResetIPThreshold:    c.Auth.Lockout.ResetIPThreshold,
+				ResendUserThreshold: c.Auth.Lockout.ResendUserThreshold,
+				ResendIPThreshold:   c.Auth.Lockout.ResendIPThreshold,
+				BaseDelay:           c.Auth.Lockout.BaseDelay,
+				MaxDelay:            c.Auth.Lockout.MaxDelay,
+				Window:              c.Auth.Lockout.Window,
+			},
+
+			PasswordResetLifetime: c.Auth.PasswordResetLifetime,
+
+			Verification: api.VerificationConfig{
+				Secret:           c.Auth.Verification.Secret,
+				Lifetime:         c.Auth.Verification.Lifetime,
+				UnverifiedAccess: c.Auth.Verification.UnverifiedAccess,
+			},
+
+			EmailConfirmLifetime: c.Auth.EmailChange.ConfirmLifetime,
+			EmailRevertLifetime:  c.Auth.EmailChange.RevertLifetime,
+
+			DeletionGracePeriod: c.Auth.DeletionGracePeriod,
+
+			ImpersonationLifetime: c.Auth.ImpersonationLifetime,
+
+			PasswordPolicy: policy,
+		},
+		Hasher:    h,
+		Mailer:    mailer,
+		PublicURL: strings.TrimSuffix(c.Server.PublicURL, "/"),
+	}
+	if err := s.Run(serverHost); err != nil {
+		return fmt.Errorf("fasthttp server error: %w", err)
+	}
+
+	return nil
+}
+
+func apiJWTConfig(c jwtConfig) api.JWTConfig {
+	keys := make([]api.JWTKey, 0, len(c.Keys))
+	for _, k := range c.Keys {
+		keys = append(keys, api.JWTKey{KID: k.KID, Key: k.Key})
+	}
+
+	return api.JWTConfig{
+		Algorithm: c.Algorithm,
+		Issuer:    c.Issuer,
+		ActiveKID: c.ActiveKID,
+		Keys:      keys,
+	}
+}
+
+func openDB(c dbConfig) (*sqldb.Storage, error) {
+	db, err := sqldb.NewStorage(sqldb.Config{
+		Driver:   c.Driver,
+		Host:     c.Host,
+		Database: c.Database,
+		User:     c.User,
+		Password: c.Password,
+		SSLMode:  c.SSLMode,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db error: %w", err)
+	}
+
+	return db, nil
+}
+
+func newHasher(c passwordConfig) (*hasher.Hasher, error) {
+	// bcrypt ignores everything after its limit, so longer passwords would be
+	// accepted without being checked in full.
+	if c.Algorithm == hasher.Bcrypt && (c.MaxLength == 0 || c.MaxLength > passwords.BcryptMaxLength) {
+		return nil, fmt.Errorf("auth.password.max_length must be between 1 and %d with bcrypt", passwords.BcryptMaxLength)
+	}
+
+	return hasher.New(hasher.Config{
+		Algorithm: c.Algorithm,
+		Argon2: hasher.Argon2Params{
+			Memory:      c.Argon2.Memory,
+			Iterations:  c.Argon2.Iterations,
+			Parallelism: c.Argon2.Parallelism,
+			SaltLength:  c.Argon2.SaltLength,
+			KeyLength:   c.Argon2.KeyLength,
+		},
+		BcryptCost: c.BcryptCost,
+	})
+}
+
+func passwordPolicy(c passwordConfig) (passwords.Policy, error) {
+	p := passwords.Policy{
+		MinLength:   c.MinLength,
+		MaxLength:   c.MaxLength,
+		MinEntropy:  c.MinEntropy,
+		CheckCommon: c.CheckCommon,
+	}
+	if c.CheckCommon && c.CommonList != "" {
+		l, err := passwords.LoadCommonList(c.CommonList)
+		if err != nil {
+			return p, fmt.Errorf("auth.password.common_list: %w", err)
+		}
+		p.CommonList = l
+	}
+
+	return p, nil
+}
+
+func migrateUp(db *sqldb.Storage) error {
+	migrations, err := sqldb.LoadMigrations(schemas.FS, db.Driver)
+	if err != nil {
+		return err
 	}
-	if err = s.Run(serverHost); err != nil {
-		log.Fatalf("fasthttp server error: %s", err)
+
+	applied, err := db.MigrateUp(migrations)
+	for _, m := range applied {
+		log.Printf("applied migration %s_%s", m.Version, m.Name)
 	}
+
+	return err
 }
 
 func initConfig(path string, conf *config) error {
 	viper.SetConfigFile(path)
+	viper.SetDefault("auth.token_lifetime", 30*24*time.Hour)
+	viper.SetDefault("auth.renew_interval", time.Minute)
+	viper.SetDefault("auth.mode", api.AuthModeOpaque)
+	viper.SetDefault("auth.jwt.algorithm", "EdDSA")
+	viper.SetDefault("auth.jwt.issuer", "todo-backend")
+	viper.SetDefault("auth.totp.issuer", "todo-backend")
+	viper.SetDefault("auth.totp.challenge_lifetime", 5*time.Minute)
+	viper.SetDefault("auth.lockout.account_threshold", 5)
+	viper.SetDefault("auth.lockout.ip_threshold", 50)
+	viper.SetDefault("auth.lockout.reset_email_threshold", 3)
+	viper.SetDefault("auth.lockout.reset_ip_threshold", 20)
+	viper.SetDefault("auth.lockout.resend_user_threshold", 3)
+	viper.SetDefault("auth.lockout.resend_ip_threshold", 20)
+	viper.SetDefault("auth.lockout.base_delay", 30*time.Second)
+	viper.SetDefault("auth.lockout.max_delay", 15*time.Minute)
+	viper.SetDefault("auth.lockout.window", time.Hour)
+	viper.SetDefault("auth.password_reset_lifetime", time.Hour)
+	viper.SetDefault("auth.verification.unverified_access", api.UnverifiedFull)
+	viper.SetDefault("auth.verification.lifetime", 48*time.Hour)
+	viper.SetDefault("auth.email_change.confirm_lifetime", 24*time.Hour)
+	viper.SetDefault("auth.email_change.revert_lifetime", 7*24*time.Hour)
+	viper.SetDefault("auth.deletion_grace_period", 7*24*time.Hour)
+	viper.SetDefault("auth.impersonation_lifetime", 30*time.Minute)
+	viper.SetDefault("auth.event_retention", 90*24*time.Hour)
+	viper.SetDefault("auth.password.algorithm", hasher.Argon2id)
+	viper.SetDefault("auth.password.argon2.memory", 19*1024)
+	viper.SetDefault("auth.password.argon2.iterations", 2)
+	viper.SetDefault("auth.password.argon2.parallelism", 1)
+	viper.SetDefault("auth.password.argon2.salt_length", 16)
+	viper.SetDefault("auth.password.argon2.key_length", 32)
+	viper.SetDefault("auth.password.bcrypt_cost", 12)
+	viper.SetDefault("auth.password.min_length", 8)
+	viper.SetDefault("auth.password.max_length", passwords.BcryptMaxLength)
+	viper.SetDefault("auth.password.min_entropy", 35)
+	viper.SetDefault("auth.password.check_common", true)
+	viper.SetDefault("auth.password.common_list", "")
+	viper.SetDefault("server.public_url", "http://localhost:8080")
+	viper.SetDefault("mail.driver", "file")
+	viper.SetDefault("mail.from", "todo@localhost")
+	viper.SetDefault("mail.smtp.port", 587)
 
 	if err := viper.ReadInConfig(); err != nil {
 		return err
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/schemas"
+	"github.com/iwajezhgf/todo-backend/storage/sqldb"
+)
+
+// schemasDir is where "migrate create" writes new files. They are picked up
+// by the binary on the next build through the embedded schemas.FS.
+const schemasDir = "schemas"
+
+var migrationNameRegexp = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+func runMigrate(c config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: migrate up|down [N]|status|baseline <version>|create <name>")
+	}
+
+	if args[0] == "create" {
+		if len(args) != 2 {
+			return errors.New("usage: migrate create <name>")
+		}
+		return createMigration(args[1])
+	}
+
+	db, err := openDB(c.DB)
+	if err != nil {
+		return err
+	}
+	defer db.DB.Close()
+
+	migrations, err := sqldb.LoadMigrations(schemas.FS, db.Driver)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		return migrateUp(db)
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			n, err = strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+
+		reverted, err := db.MigrateDown(migrations, n)
+		for _, m := range reverted {
+			fmt.Printf("reverted migration %s_%s\n", m.Version, m.Name)
+		}
+		return err
+	case "baseline":
+		if len(args) != 2 {
+			return errors.New("usage: migrate baseline <version>")
+		}
+
+		recorded, err := db.Baseline(migrations, args[1])
+		for _, m := range recorded {
+			fmt.Printf("marked migration %s_%s as applied\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		status, err := db.MigrationStatus(migrations)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range status {
+			state := "pending"
+			if m.Applied {
+				state = "applied " + m.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s_%s\t%s\n", m.Version, m.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+// createMigration writes empty up and down files for every driver, so the
+// schemas of the backends stay in step.
+func createMigration(name string) error {
+	if !migrationNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid migration name %q: use lowercase letters, digits and underscores", name)
+	}
+
+	version := time.Now().UTC().Format("20060102150405")
+	for _, driver := range []string{sqldb.MySQL, sqldb.SQLite, sqldb.Postgres} {
+		for _, direction := range []string{"up", "down"} {
+			path := filepath.Join(schemasDir, driver, fmt.Sprintf("%s_%s.%s.sql", version, name, direction))
+			header := fmt.Sprintf("-- %s (%s)\n", name, direction)
+			if err := os.WriteFile(path, []byte(header), 0o644); err != nil {
+				return err
+			}
+			fmt.Println("created", path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,207 @@
+// Package passwords decides whether a password is strong enough to be set.
+package passwords
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BcryptMaxLength is the number of bytes bcrypt looks at; anything after it is
+// silently ignored.
+const BcryptMaxLength = 72
+
+var (
+	ErrTooShort      = errors.New("password is too short")
+	ErrTooLong       = errors.New("password is too long")
+	ErrTooWeak       = errors.New("password is too easy to guess")
+	ErrContainsEmail = errors.New("password contains the email address")
+	ErrCommon        = errors.New("password is on the list of common passwords")
+)
+
+// Policy holds the rules a new password must follow.
+type Policy struct {
+	// MinLength is counted in characters.
+	MinLength int
+	// MaxLength is counted in bytes, so it can keep passwords within
+	// BcryptMaxLength. Zero disables it.
+	MaxLength int
+	// MinEntropy is the estimated strength in bits, see Entropy.
+	MinEntropy float64
+	// CheckCommon rejects passwords on the bundled list of common and
+	// breached passwords, or on CommonList when it is not nil.
+	CheckCommon bool
+	CommonList  CommonList
+}
+
+// Check returns the first rule password breaks for the account with the
+// given email address, or nil.
+func (p Policy) Check(password, email string) error {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		return ErrTooShort
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		return ErrTooLong
+	}
+
+	lower := strings.ToLower(password)
+	// Very short local parts such as "a" would rule out too many passwords.
+	if local, _, ok := strings.Cut(strings.ToLower(email), "@"); ok && len(local) >= 3 && strings.Contains(lower, local) {
+		return ErrContainsEmail
+	}
+
+	if p.CheckCommon && p.isCommon(lower) {
+		return ErrCommon
+	}
+
+	if Entropy(password) < p.MinEntropy {
+		return ErrTooWeak
+	}
+
+	return nil
+}
+
+// Entropy estimates the strength of password in bits from the character
+// classes it uses and its length. Characters that repeat the previous one or
+// continue a run such as "abc" or "321" do not count towards the length.
+func Entropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	n := 0
+	prev, step := rune(-1), rune(0)
+	for _, r := range password {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLower(r):
+			lower = true
+		case r < utf8.RuneSelf && unicode.IsUpper(r):
+			upper = true
+		case r < utf8.RuneSelf && unicode.IsDigit(r):
+			digit = true
+		case r < utf8.RuneSelf:
+			symbol = true
+		default:
+			other = true
+		}
+
+		d := r - prev
+		switch {
+		case d == 0:
+		case (d == 1 || d == -1) && d == step:
+		default:
+			n++
+		}
+		if d == 1 || d == -1 {
+			step = d
+		} else {
+			step = 0
+		}
+		prev = r
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	return float64(n) * math.Log2(float64(pool))
+}
+
+// CommonList is a set of lowercased common passwords.
+type CommonList map[string]struct{}
+
+// LoadCommonList reads a list with one password per line from the file at
+// path, which is gunzipped when its name ends in ".gz".
+func LoadCommonList(path string) (CommonList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r = gz
+	}
+
+	l, err := readCommonList(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return l, nil
+}
+
+func readCommonList(r io.Reader) (CommonList, error) {
+	l := make(CommonList)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		if line := strings.ToLower(strings.TrimSpace(sc.Text())); line != "" {
+			l[line] = struct{}{}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// The bundled list only holds the few hundred most common passwords, so that
+// it stays small enough to embed; larger lists are loaded into CommonList.
+//
+//go:embed common.txt.gz
+var commonGz []byte
+
+var (
+	commonOnce sync.Once
+	common     CommonList
+)
+
+// isCommon reports whether the lowercased password is on CommonList or on the
+// bundled list, which is unpacked on first use.
+func (p Policy) isCommon(password string) bool {
+	if p.CommonList != nil {
+		_, ok := p.CommonList[password]
+		return ok
+	}
+
+	commonOnce.Do(func() {
+		r, err := gzip.NewReader(bytes.NewReader(commonGz))
+		if err == nil {
+			common, err = readCommonList(r)
+		}
+		if err != nil {
+			panic("passwords: bad common password list: " + err.Error())
+		}
+	})
+
+	_, ok := common[password]
+	return ok
+}
@@ -0,0 +1,136 @@
+package passwords
+
+import (
+	"compress/gzip"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// defaultPolicy has the defaults of config.yml.
+var defaultPolicy = Policy{MinLength: 8, MaxLength: BcryptMaxLength, MinEntropy: 35, CheckCommon: true}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		p        Policy
+		password string
+		email    string
+		err      error
+	}{
+		{"strong", defaultPolicy, "Q7#vK2!m", "ann@example.com", nil},
+		{"one short", defaultPolicy, "Q7#vK2!", "ann@example.com", ErrTooShort},
+		// The minimum counts characters, not bytes.
+		{"multibyte at the minimum", defaultPolicy, "Ää#1ÖöÜü", "ann@example.com", nil},
+		{"at the maximum", defaultPolicy, "Q7#vK2!m" + strings.Repeat("x", BcryptMaxLength-8), "ann@example.com", nil},
+		{"one over the maximum", defaultPolicy, "Q7#vK2!m" + strings.Repeat("x", BcryptMaxLength-7), "ann@example.com", ErrTooLong},
+		// The maximum counts bytes, so 40 two-byte characters are too long.
+		{"multibyte over the maximum", defaultPolicy, strings.Repeat("ä", 40), "ann@example.com", ErrTooLong},
+		{"no maximum", Policy{MinLength: 8}, strings.Repeat("Q7#vK2!m", 20), "ann@example.com", nil},
+		{"contains email", defaultPolicy, "x9#Q-annasmith", "annasmith@example.com", ErrContainsEmail},
+		{"contains email in other case", defaultPolicy, "x9#Q-AnnaSmith", "ANNASMITH@example.com", ErrContainsEmail},
+		{"short local part", defaultPolicy, "Q7#vK2!mab", "ab@example.com", nil},
+		{"common", defaultPolicy, "p@ssw0rd", "ann@example.com", ErrCommon},
+		{"common in other case", defaultPolicy, "P@SSW0RD", "ann@example.com", ErrCommon},
+		{"common not checked", Policy{MinLength: 8}, "P@SSW0RD", "ann@example.com", nil},
+		{"repeated characters", defaultPolicy, "aaaaaaaaaaaaaaaa", "ann@example.com", ErrTooWeak},
+		{"run of characters", defaultPolicy, "abcdefghijklmnop", "ann@example.com", ErrTooWeak},
+		{"at the entropy threshold", Policy{MinEntropy: Entropy("Q7#vK2!m")}, "Q7#vK2!m", "", nil},
+		{"below the entropy threshold", Policy{MinEntropy: math.Nextafter(Entropy("Q7#vK2!m"), 100)}, "Q7#vK2!m", "", ErrTooWeak},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.p.Check(tt.password, tt.email); !errors.Is(err, tt.err) {
+				t.Errorf("Check(%q, %q) = %v, want %v", tt.password, tt.email, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckCommonList(t *testing.T) {
+	p := defaultPolicy
+	p.CommonList = CommonList{"correct horse battery staple": {}}
+
+	if err := p.Check("Correct Horse Battery Staple", "ann@example.com"); !errors.Is(err, ErrCommon) {
+		t.Errorf("Check of a password on the list = %v, want %v", err, ErrCommon)
+	}
+	// The list replaces the bundled one.
+	if err := p.Check("P@SSW0RD", "ann@example.com"); err != nil {
+		t.Errorf("Check of a password only on the bundled list = %v, want nil", err)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	bits := func(n, pool int) float64 {
+		return float64(n) * math.Log2(float64(pool))
+	}
+
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{"", 0},
+		{"qwzx", bits(4, 26)},
+		{"aaaa", bits(1, 26)},
+		{"abcd", bits(2, 26)},
+		{"4321", bits(2, 10)},
+		{"aB3$", bits(4, 26+26+10+33)},
+		{"añb", bits(3, 26+100)},
+	}
+	for _, tt := range tests {
+		if got := Entropy(tt.password); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Entropy(%q) = %f, want %f", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestLoadCommonList(t *testing.T) {
+	dir := t.TempDir()
+	content := "Hunter2\n\n  letmein  \n"
+
+	plain := filepath.Join(dir, "common.txt")
+	if err := os.WriteFile(plain, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	gzipped := filepath.Join(dir, "common.txt.gz")
+	f, err := os.Create(gzipped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := gzip.NewWriter(f)
+	if _, err = w.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{plain, gzipped} {
+		l, err := LoadCommonList(path)
+		if err != nil {
+			t.Fatalf("LoadCommonList(%s): %v", path, err)
+		}
+		_, hunter := l["hunter2"]
+		_, letmein := l["letmein"]
+		if len(l) != 2 || !hunter || !letmein {
+			t.Errorf("LoadCommonList(%s) = %v, want hunter2 and letmein", path, l)
+		}
+	}
+
+	notGzipped := filepath.Join(dir, "plain.gz")
+	if err = os.WriteFile(notGzipped, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{notGzipped, filepath.Join(dir, "missing.txt")} {
+		if _, err = LoadCommonList(path); err == nil {
+			t.Errorf("LoadCommonList(%s) succeeded, want an error", path)
+		}
+	}
+}
@@ -0,0 +1,9 @@
+ALTER TABLE tokens
+    ADD COLUMN created   DATETIME NULL,
+    ADD COLUMN last_used DATETIME NULL;
+
+UPDATE tokens SET created = UTC_TIMESTAMP(), last_used = UTC_TIMESTAMP();
+
+ALTER TABLE tokens
+    MODIFY created   DATETIME NOT NULL,
+    MODIFY last_used DATETIME NOT NULL;
@@ -0,0 +1,4 @@
+-- Digests cannot be turned back into bearer tokens, so every session is dropped.
+DELETE FROM tokens;
+
+ALTER TABLE tokens RENAME COLUMN token_hash TO token;
@@ -0,0 +1,14 @@
+ALTER TABLE tokens ADD COLUMN session_expire DATETIME NULL;
+
+CREATE TABLE refresh_tokens
+(
+    id         BIGINT AUTO_INCREMENT,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    session_id BIGINT      NOT NULL,
+    user_id    BIGINT      NOT NULL,
+    created    DATETIME    NOT NULL,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    FOREIGN KEY (session_id) REFERENCES tokens (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE personal_tokens
+(
+    id         BIGINT AUTO_INCREMENT,
+    token_hash VARCHAR(64)  NOT NULL UNIQUE,
+    name       VARCHAR(255) NOT NULL DEFAULT '',
+    scopes     VARCHAR(255) NOT NULL,
+    created    DATETIME     NOT NULL,
+    last_used  DATETIME     NULL,
+    expire     DATETIME     NULL,
+    user_id    BIGINT       NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,32 @@
+CREATE TABLE two_factor
+(
+    user_id   BIGINT      NOT NULL,
+    secret    VARCHAR(64) NOT NULL,
+    enabled   BOOLEAN     NOT NULL DEFAULT FALSE,
+    last_step BIGINT      NOT NULL DEFAULT 0,
+    created   DATETIME    NOT NULL,
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE recovery_codes
+(
+    id        BIGINT AUTO_INCREMENT,
+    code_hash VARCHAR(64) NOT NULL,
+    user_id   BIGINT      NOT NULL,
+    used      BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    INDEX recovery_codes_user_id (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE login_challenges
+(
+    id         BIGINT AUTO_INCREMENT,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    user_id    BIGINT      NOT NULL,
+    attempts   INT         NOT NULL DEFAULT 0,
+    expire     DATETIME    NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,8 @@
+CREATE TABLE login_attempts
+(
+    attempt_key  VARCHAR(320) NOT NULL,
+    failures     INT          NOT NULL DEFAULT 0,
+    locked_until DATETIME     NULL,
+    expire       DATETIME     NOT NULL,
+    PRIMARY KEY (attempt_key)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE password_resets
+(
+    id         BIGINT AUTO_INCREMENT,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    user_id    BIGINT      NOT NULL,
+    created    DATETIME    NOT NULL,
+    expire     DATETIME    NOT NULL,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE email_changes
+(
+    id         BIGINT AUTO_INCREMENT,
+    token_hash VARCHAR(64)  NOT NULL UNIQUE,
+    kind       VARCHAR(16)  NOT NULL,
+    user_id    BIGINT       NOT NULL,
+    old_email  VARCHAR(255) NOT NULL,
+    new_email  VARCHAR(255) NOT NULL,
+    created    DATETIME     NOT NULL,
+    expire     DATETIME     NOT NULL,
+    used       BOOLEAN      NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
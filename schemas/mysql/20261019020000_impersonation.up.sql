@@ -0,0 +1,28 @@
+-- No foreign keys to users: the audit trail outlives deleted accounts.
+CREATE TABLE impersonations
+(
+    id         BIGINT AUTO_INCREMENT,
+    token_hash VARCHAR(64)  NOT NULL UNIQUE,
+    admin_id   BIGINT       NOT NULL,
+    user_id    BIGINT       NOT NULL,
+    reason     VARCHAR(255) NOT NULL DEFAULT '',
+    created    DATETIME     NOT NULL,
+    expire     DATETIME     NOT NULL,
+    ended      DATETIME     NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE impersonation_audit
+(
+    id               BIGINT AUTO_INCREMENT,
+    impersonation_id BIGINT        NOT NULL,
+    admin_id         BIGINT        NOT NULL,
+    user_id          BIGINT        NOT NULL,
+    action           VARCHAR(16)   NOT NULL,
+    method           VARCHAR(16)   NOT NULL DEFAULT '',
+    path             VARCHAR(1024) NOT NULL DEFAULT '',
+    status           INT           NOT NULL DEFAULT 0,
+    created          DATETIME      NOT NULL,
+    PRIMARY KEY (id),
+    INDEX impersonation_audit_impersonation_id (impersonation_id)
+);
@@ -0,0 +1,18 @@
+-- Rows are only ever inserted, and deleted once they are older than the
+-- retention period. No foreign key to users, so failed logins for unknown
+-- emails and the events of deleted accounts are kept too.
+CREATE TABLE auth_events
+(
+    id         BIGINT AUTO_INCREMENT,
+    user_id    BIGINT       NULL,
+    email      VARCHAR(255) NOT NULL DEFAULT '',
+    type       VARCHAR(32)  NOT NULL,
+    outcome    VARCHAR(16)  NOT NULL,
+    reason     VARCHAR(64)  NOT NULL DEFAULT '',
+    ip         VARCHAR(45)  NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    created    DATETIME     NOT NULL,
+    PRIMARY KEY (id),
+    INDEX auth_events_user_id (user_id, id),
+    INDEX auth_events_created (created)
+);
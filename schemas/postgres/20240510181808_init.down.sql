@@ -0,0 +1,3 @@
+DROP TABLE tokens;
+DROP TABLE todos;
+DROP TABLE users;
@@ -0,0 +1,32 @@
+CREATE EXTENSION IF NOT EXISTS citext;
+
+CREATE TABLE users
+(
+    id       BIGSERIAL,
+    email    CITEXT NOT NULL UNIQUE,
+    password BYTEA  NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE tokens
+(
+    id      BIGSERIAL,
+    token   VARCHAR(255) UNIQUE,
+    expire  TIMESTAMPTZ,
+    user_id BIGINT,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE todos
+(
+    id      BIGSERIAL,
+    title   VARCHAR(255) NOT NULL,
+    note    TEXT         NOT NULL,
+    created TIMESTAMPTZ  NOT NULL,
+    expire  TIMESTAMPTZ  NOT NULL,
+    status  VARCHAR(15)  NOT NULL DEFAULT 'active',
+    user_id BIGINT,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
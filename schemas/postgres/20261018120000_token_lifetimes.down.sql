@@ -0,0 +1,3 @@
+ALTER TABLE tokens
+    DROP COLUMN created,
+    DROP COLUMN last_used;
@@ -0,0 +1,9 @@
+ALTER TABLE tokens
+    ADD COLUMN created   TIMESTAMPTZ NULL,
+    ADD COLUMN last_used TIMESTAMPTZ NULL;
+
+UPDATE tokens SET created = CURRENT_TIMESTAMP, last_used = CURRENT_TIMESTAMP;
+
+ALTER TABLE tokens
+    ALTER COLUMN created SET NOT NULL,
+    ALTER COLUMN last_used SET NOT NULL;
@@ -0,0 +1,4 @@
+ALTER TABLE tokens RENAME COLUMN token TO token_hash;
+
+-- Existing sessions keep working: the stored value becomes the digest of the bearer token.
+UPDATE tokens SET token_hash = encode(sha256(convert_to(token_hash, 'UTF8')), 'hex');
@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    DROP COLUMN name,
+    DROP COLUMN user_agent,
+    DROP COLUMN ip;
@@ -0,0 +1,4 @@
+ALTER TABLE tokens
+    ADD COLUMN name       VARCHAR(255) NOT NULL DEFAULT '',
+    ADD COLUMN user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    ADD COLUMN ip         VARCHAR(45)  NOT NULL DEFAULT '';
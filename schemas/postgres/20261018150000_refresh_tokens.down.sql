@@ -0,0 +1,3 @@
+DROP TABLE refresh_tokens;
+
+ALTER TABLE tokens DROP COLUMN session_expire;
@@ -0,0 +1,14 @@
+ALTER TABLE tokens ADD COLUMN session_expire TIMESTAMPTZ NULL;
+
+CREATE TABLE refresh_tokens
+(
+    id         BIGSERIAL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    session_id BIGINT      NOT NULL,
+    user_id    BIGINT      NOT NULL,
+    created    TIMESTAMPTZ NOT NULL,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    FOREIGN KEY (session_id) REFERENCES tokens (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
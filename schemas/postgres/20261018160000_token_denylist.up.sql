@@ -0,0 +1,6 @@
+CREATE TABLE token_denylist
+(
+    token_hash VARCHAR(64) NOT NULL,
+    expire     TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (token_hash)
+);
@@ -0,0 +1,13 @@
+CREATE TABLE personal_tokens
+(
+    id         BIGSERIAL,
+    token_hash VARCHAR(64)  NOT NULL UNIQUE,
+    name       VARCHAR(255) NOT NULL DEFAULT '',
+    scopes     VARCHAR(255) NOT NULL,
+    created    TIMESTAMPTZ  NOT NULL,
+    last_used  TIMESTAMPTZ  NULL,
+    expire     TIMESTAMPTZ  NULL,
+    user_id    BIGINT       NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
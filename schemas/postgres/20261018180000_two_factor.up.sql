@@ -0,0 +1,33 @@
+CREATE TABLE two_factor
+(
+    user_id   BIGINT      NOT NULL,
+    secret    VARCHAR(64) NOT NULL,
+    enabled   BOOLEAN     NOT NULL DEFAULT FALSE,
+    last_step BIGINT      NOT NULL DEFAULT 0,
+    created   TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (user_id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE recovery_codes
+(
+    id        BIGSERIAL,
+    code_hash VARCHAR(64) NOT NULL,
+    user_id   BIGINT      NOT NULL,
+    used      BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX recovery_codes_user_id ON recovery_codes (user_id, code_hash);
+
+CREATE TABLE login_challenges
+(
+    id         BIGSERIAL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    user_id    BIGINT      NOT NULL,
+    attempts   INT         NOT NULL DEFAULT 0,
+    expire     TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,11 @@
+CREATE TABLE password_resets
+(
+    id         BIGSERIAL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    user_id    BIGINT      NOT NULL,
+    created    TIMESTAMPTZ NOT NULL,
+    expire     TIMESTAMPTZ NOT NULL,
+    used       BOOLEAN     NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (id),
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
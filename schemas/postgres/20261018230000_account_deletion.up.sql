@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN delete_after TIMESTAMPTZ NULL;
@@ -0,0 +1,29 @@
+-- No foreign keys to users: the audit trail outlives deleted accounts.
+CREATE TABLE impersonations
+(
+    id         BIGSERIAL,
+    token_hash VARCHAR(64)  NOT NULL UNIQUE,
+    admin_id   BIGINT       NOT NULL,
+    user_id    BIGINT       NOT NULL,
+    reason     VARCHAR(255) NOT NULL DEFAULT '',
+    created    TIMESTAMPTZ  NOT NULL,
+    expire     TIMESTAMPTZ  NOT NULL,
+    ended      TIMESTAMPTZ  NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE TABLE impersonation_audit
+(
+    id               BIGSERIAL,
+    impersonation_id BIGINT        NOT NULL,
+    admin_id         BIGINT        NOT NULL,
+    user_id          BIGINT        NOT NULL,
+    action           VARCHAR(16)   NOT NULL,
+    method           VARCHAR(16)   NOT NULL DEFAULT '',
+    path             VARCHAR(1024) NOT NULL DEFAULT '',
+    status           INT           NOT NULL DEFAULT 0,
+    created          TIMESTAMPTZ   NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX impersonation_audit_impersonation_id ON impersonation_audit (impersonation_id);
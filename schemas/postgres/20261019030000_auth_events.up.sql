@@ -0,0 +1,19 @@
+-- Rows are only ever inserted, and deleted once they are older than the
+-- retention period. No foreign key to users, so failed logins for unknown
+-- emails and the events of deleted accounts are kept too.
+CREATE TABLE auth_events
+(
+    id         BIGSERIAL,
+    user_id    BIGINT       NULL,
+    email      VARCHAR(255) NOT NULL DEFAULT '',
+    type       VARCHAR(32)  NOT NULL,
+    outcome    VARCHAR(16)  NOT NULL,
+    reason     VARCHAR(64)  NOT NULL DEFAULT '',
+    ip         VARCHAR(45)  NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    created    TIMESTAMPTZ  NOT NULL,
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX auth_events_user_id ON auth_events (user_id, id);
+CREATE INDEX auth_events_created ON auth_events (created);
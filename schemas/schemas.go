@@ -0,0 +1,9 @@
+// Package schemas embeds the SQL migrations for every supported database.
+// Each driver has its own directory with <version>_<name>.up.sql and
+// <version>_<name>.down.sql files, where version is a UTC timestamp.
+package schemas
+
+import "embed"
+
+//go:embed mysql/*.sql sqlite/*.sql postgres/*.sql
+var FS embed.FS
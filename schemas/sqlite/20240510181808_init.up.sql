@@ -0,0 +1,27 @@
+CREATE TABLE users
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    email    TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    password BLOB NOT NULL
+);
+
+CREATE TABLE tokens
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    token   TEXT UNIQUE,
+    expire  DATETIME,
+    user_id INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE todos
+(
+    id      INTEGER PRIMARY KEY AUTOINCREMENT,
+    title   TEXT     NOT NULL,
+    note    TEXT     NOT NULL,
+    created DATETIME NOT NULL,
+    expire  DATETIME NOT NULL,
+    status  TEXT     NOT NULL DEFAULT 'active',
+    user_id INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
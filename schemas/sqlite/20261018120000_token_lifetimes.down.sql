@@ -0,0 +1,2 @@
+ALTER TABLE tokens DROP COLUMN created;
+ALTER TABLE tokens DROP COLUMN last_used;
@@ -0,0 +1,4 @@
+ALTER TABLE tokens ADD COLUMN created DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+ALTER TABLE tokens ADD COLUMN last_used DATETIME NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+UPDATE tokens SET created = CURRENT_TIMESTAMP, last_used = CURRENT_TIMESTAMP;
@@ -0,0 +1,4 @@
+ALTER TABLE tokens RENAME COLUMN token TO token_hash;
+
+-- SQLite has no built-in SHA-256, so existing sessions are invalidated instead.
+DELETE FROM tokens;
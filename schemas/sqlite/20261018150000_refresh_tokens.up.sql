@@ -0,0 +1,13 @@
+ALTER TABLE tokens ADD COLUMN session_expire DATETIME NULL;
+
+CREATE TABLE refresh_tokens
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT     NOT NULL UNIQUE,
+    session_id INTEGER  NOT NULL,
+    user_id    INTEGER  NOT NULL,
+    created    DATETIME NOT NULL,
+    used       BOOLEAN  NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (session_id) REFERENCES tokens (id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,5 @@
+CREATE TABLE token_denylist
+(
+    token_hash TEXT     NOT NULL PRIMARY KEY,
+    expire     DATETIME NOT NULL
+);
@@ -0,0 +1,12 @@
+CREATE TABLE personal_tokens
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT     NOT NULL UNIQUE,
+    name       TEXT     NOT NULL DEFAULT '',
+    scopes     TEXT     NOT NULL,
+    created    DATETIME NOT NULL,
+    last_used  DATETIME NULL,
+    expire     DATETIME NULL,
+    user_id    INTEGER  NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
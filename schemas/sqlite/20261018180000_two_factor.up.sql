@@ -0,0 +1,30 @@
+CREATE TABLE two_factor
+(
+    user_id   INTEGER  NOT NULL PRIMARY KEY,
+    secret    TEXT     NOT NULL,
+    enabled   BOOLEAN  NOT NULL DEFAULT FALSE,
+    last_step INTEGER  NOT NULL DEFAULT 0,
+    created   DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE TABLE recovery_codes
+(
+    id        INTEGER PRIMARY KEY AUTOINCREMENT,
+    code_hash TEXT    NOT NULL,
+    user_id   INTEGER NOT NULL,
+    used      BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
+
+CREATE INDEX recovery_codes_user_id ON recovery_codes (user_id, code_hash);
+
+CREATE TABLE login_challenges
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT     NOT NULL UNIQUE,
+    user_id    INTEGER  NOT NULL,
+    attempts   INTEGER  NOT NULL DEFAULT 0,
+    expire     DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,7 @@
+CREATE TABLE login_attempts
+(
+    attempt_key  TEXT     NOT NULL PRIMARY KEY,
+    failures     INTEGER  NOT NULL DEFAULT 0,
+    locked_until DATETIME NULL,
+    expire       DATETIME NOT NULL
+);
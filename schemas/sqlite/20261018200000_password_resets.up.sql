@@ -0,0 +1,10 @@
+CREATE TABLE password_resets
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT     NOT NULL UNIQUE,
+    user_id    INTEGER  NOT NULL,
+    created    DATETIME NOT NULL,
+    expire     DATETIME NOT NULL,
+    used       BOOLEAN  NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
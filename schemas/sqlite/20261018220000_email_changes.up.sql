@@ -0,0 +1,13 @@
+CREATE TABLE email_changes
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT     NOT NULL UNIQUE,
+    kind       TEXT     NOT NULL,
+    user_id    INTEGER  NOT NULL,
+    old_email  TEXT     NOT NULL,
+    new_email  TEXT     NOT NULL,
+    created    DATETIME NOT NULL,
+    expire     DATETIME NOT NULL,
+    used       BOOLEAN  NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users (id)
+);
@@ -0,0 +1,5 @@
+ALTER TABLE users DROP COLUMN avatar_url;
+ALTER TABLE users DROP COLUMN week_start;
+ALTER TABLE users DROP COLUMN locale;
+ALTER TABLE users DROP COLUMN time_zone;
+ALTER TABLE users DROP COLUMN display_name;
@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC';
+ALTER TABLE users ADD COLUMN locale TEXT NOT NULL DEFAULT 'en';
+ALTER TABLE users ADD COLUMN week_start TEXT NOT NULL DEFAULT 'monday';
+ALTER TABLE users ADD COLUMN avatar_url TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+DROP TABLE impersonation_audit;
+DROP TABLE impersonations;
@@ -0,0 +1,27 @@
+-- No foreign keys to users: the audit trail outlives deleted accounts.
+CREATE TABLE impersonations
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    token_hash TEXT     NOT NULL UNIQUE,
+    admin_id   INTEGER  NOT NULL,
+    user_id    INTEGER  NOT NULL,
+    reason     TEXT     NOT NULL DEFAULT '',
+    created    DATETIME NOT NULL,
+    expire     DATETIME NOT NULL,
+    ended      DATETIME NULL
+);
+
+CREATE TABLE impersonation_audit
+(
+    id               INTEGER PRIMARY KEY AUTOINCREMENT,
+    impersonation_id INTEGER  NOT NULL,
+    admin_id         INTEGER  NOT NULL,
+    user_id          INTEGER  NOT NULL,
+    action           TEXT     NOT NULL,
+    method           TEXT     NOT NULL DEFAULT '',
+    path             TEXT     NOT NULL DEFAULT '',
+    status           INTEGER  NOT NULL DEFAULT 0,
+    created          DATETIME NOT NULL
+);
+
+CREATE INDEX impersonation_audit_impersonation_id ON impersonation_audit (impersonation_id);
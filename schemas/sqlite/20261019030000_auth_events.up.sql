@@ -0,0 +1,18 @@
+-- Rows are only ever inserted, and deleted once they are older than the
+-- retention period. No foreign key to users, so failed logins for unknown
+-- emails and the events of deleted accounts are kept too.
+CREATE TABLE auth_events
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id    INTEGER  NULL,
+    email      TEXT     NOT NULL DEFAULT '',
+    type       TEXT     NOT NULL,
+    outcome    TEXT     NOT NULL,
+    reason     TEXT     NOT NULL DEFAULT '',
+    ip         TEXT     NOT NULL DEFAULT '',
+    user_agent TEXT     NOT NULL DEFAULT '',
+    created    DATETIME NOT NULL
+);
+
+CREATE INDEX auth_events_user_id ON auth_events (user_id, id);
+CREATE INDEX auth_events_created ON auth_events (created);
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type AttemptStorage struct {
+	*Storage
+}
+
+func (s *AttemptStorage) Get(key string) (*types.LoginAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	attempt := *a
+	return &attempt, nil
+}
+
+func (s *AttemptStorage) Fail(key string, expire time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attempts[key]
+	if !ok {
+		a = &types.LoginAttempt{Key: key}
+		s.attempts[key] = a
+	}
+
+	if a.Expire.Before(time.Now().UTC()) {
+		a.Failures = 0
+	}
+	a.Failures++
+	a.Expire = expire
+
+	return a.Failures, nil
+}
+
+func (s *AttemptStorage) Lock(key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if a, ok := s.attempts[key]; ok {
+		a.LockedUntil = &until
+	}
+
+	return nil
+}
+
+func (s *AttemptStorage) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.attempts, key)
+
+	return nil
+}
+
+func (s *AttemptStorage) CleanupExpiredTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for key, a := range s.attempts {
+		if a.Expire.Before(now) && (a.LockedUntil == nil || a.LockedUntil.Before(now)) {
+			delete(s.attempts, key)
+		}
+	}
+}
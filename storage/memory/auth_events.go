@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type AuthEventStorage struct {
+	*Storage
+}
+
+func (s *AuthEventStorage) Record(e types.AuthEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAuthEventID++
+	e.ID = s.lastAuthEventID
+	s.authEvents = append(s.authEvents, e)
+
+	return nil
+}
+
+func (s *AuthEventStorage) Search(f types.AuthEventFilter, page, limit int) (*types.AuthEventData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := make([]types.AuthEvent, 0)
+	// Newest first, like the database stores.
+	for i := len(s.authEvents) - 1; i >= 0; i-- {
+		e := s.authEvents[i]
+		switch {
+		case f.UserID != 0 && (e.UserID == nil || *e.UserID != f.UserID),
+			f.Email != "" && !strings.EqualFold(e.Email, f.Email),
+			f.Type != "" && e.Type != f.Type,
+			f.Outcome != "" && e.Outcome != f.Outcome,
+			f.IP != "" && e.IP != f.IP,
+			f.Since != nil && e.Created.Before(*f.Since),
+			f.Until != nil && !e.Created.Before(*f.Until):
+			continue
+		}
+		matches = append(matches, e)
+	}
+
+	events := make([]types.AuthEvent, 0)
+	if offset := (page - 1) * limit; offset >= 0 && offset < len(matches) {
+		end := offset + limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		events = append(events, matches[offset:end]...)
+	}
+
+	return &types.AuthEventData{
+		Items:      events,
+		Pagination: storage.NewPagination(page, limit, len(matches)),
+	}, nil
+}
+
+func (s *AuthEventStorage) DeleteBefore(t time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.authEvents[:0]
+	for _, e := range s.authEvents {
+		if !e.Created.Before(t) {
+			kept = append(kept, e)
+		}
+	}
+	n := int64(len(s.authEvents) - len(kept))
+	s.authEvents = kept
+
+	return n, nil
+}
@@ -0,0 +1,73 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type EmailChangeStorage struct {
+	*Storage
+}
+
+func (s *EmailChangeStorage) Create(
+	token, kind string, userId uint64, oldEmail, newEmail string, expire time.Time,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastEmailChangeID++
+	s.emailChanges[s.lastEmailChangeID] = &types.EmailChange{
+		ID:        s.lastEmailChangeID,
+		TokenHash: storage.HashToken(token),
+		Kind:      kind,
+		UserID:    userId,
+		OldEmail:  oldEmail,
+		NewEmail:  newEmail,
+		Created:   time.Now().UTC(),
+		Expire:    expire,
+	}
+
+	return nil
+}
+
+func (s *EmailChangeStorage) GetByToken(token string) (*types.EmailChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := storage.HashToken(token)
+	for _, c := range s.emailChanges {
+		if c.TokenHash == hash {
+			change := *c
+			return &change, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *EmailChangeStorage) Use(id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.emailChanges[id]
+	if !ok || c.Used {
+		return false, nil
+	}
+
+	c.Used = true
+	return true, nil
+}
+
+func (s *EmailChangeStorage) CleanupExpiredTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, c := range s.emailChanges {
+		if c.Expire.Before(now) {
+			delete(s.emailChanges, id)
+		}
+	}
+}
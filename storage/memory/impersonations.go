@@ -0,0 +1,113 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type ImpersonationStorage struct {
+	*Storage
+}
+
+func (s *ImpersonationStorage) Create(token string, adminId, userId uint64, reason string, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastImpersonationID++
+	s.impersonations[s.lastImpersonationID] = &types.Impersonation{
+		ID:        s.lastImpersonationID,
+		TokenHash: storage.HashToken(token),
+		AdminID:   adminId,
+		UserID:    userId,
+		Reason:    reason,
+		Created:   time.Now().UTC(),
+		Expire:    expire,
+	}
+
+	return nil
+}
+
+func (s *ImpersonationStorage) GetByToken(token string) (*types.Impersonation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := storage.HashToken(token)
+	for _, imp := range s.impersonations {
+		if imp.TokenHash == hash {
+			i := *imp
+			return &i, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *ImpersonationStorage) GetById(id uint64) (*types.Impersonation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	imp, ok := s.impersonations[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	i := *imp
+	return &i, nil
+}
+
+func (s *ImpersonationStorage) GetActiveByUser(userId uint64, now time.Time) ([]types.Impersonation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	imps := make([]types.Impersonation, 0)
+	for _, imp := range s.impersonations {
+		if (imp.AdminID == userId || imp.UserID == userId) && imp.Ended == nil && imp.Expire.After(now) {
+			imps = append(imps, *imp)
+		}
+	}
+
+	sort.Slice(imps, func(i, j int) bool { return imps[i].ID < imps[j].ID })
+
+	return imps, nil
+}
+
+func (s *ImpersonationStorage) End(id uint64, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	imp, ok := s.impersonations[id]
+	if !ok || imp.Ended != nil {
+		return false, nil
+	}
+	imp.Ended = &at
+
+	return true, nil
+}
+
+func (s *ImpersonationStorage) Record(e types.ImpersonationAudit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAuditID++
+	e.ID = s.lastAuditID
+	s.impersonationAudit = append(s.impersonationAudit, e)
+
+	return nil
+}
+
+func (s *ImpersonationStorage) GetAudit(impersonationId uint64) ([]types.ImpersonationAudit, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	entries := make([]types.ImpersonationAudit, 0)
+	for _, e := range s.impersonationAudit {
+		if e.ImpersonationID == impersonationId {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,76 @@
+package memory
+
+import (
+	"sync"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+// Storage keeps all records in process memory. It is safe for concurrent use
+// and loses everything on restart, which makes it suitable for tests and demos.
+type Storage struct {
+	mu sync.RWMutex
+
+	users          map[uint64]*types.User
+	tokens         map[uint64]*types.Token
+	refreshTokens  map[uint64]*types.RefreshToken
+	personalTokens map[uint64]*types.PersonalToken
+	todos          map[uint64]*types.Todo
+	denied         map[string]time.Time
+	twoFactor      map[uint64]*types.TwoFactor
+	recoveryCodes  map[uint64]map[string]bool // user ID -> code digest -> used
+	challenges     map[uint64]*types.LoginChallenge
+	attempts       map[string]*types.LoginAttempt
+	passwordResets map[uint64]*types.PasswordReset
+	emailChanges   map[uint64]*types.EmailChange
+	impersonations map[uint64]*types.Impersonation
+	// impersonationAudit is kept in the order it was recorded.
+	impersonationAudit []types.ImpersonationAudit
+	// authEvents is kept in the order it was recorded.
+	authEvents []types.AuthEvent
+
+	lastUserID          uint64
+	lastTokenID         uint64
+	lastRefreshID       uint64
+	lastPersonalTokenID uint64
+	lastTodoID          uint64
+	lastChallengeID     uint64
+	lastPasswordResetID uint64
+	lastEmailChangeID   uint64
+	lastImpersonationID uint64
+	lastAuditID         uint64
+	lastAuthEventID     uint64
+}
+
+func NewStorage() *Storage {
+	return &Storage{
+		users:          make(map[uint64]*types.User),
+		tokens:         make(map[uint64]*types.Token),
+		refreshTokens:  make(map[uint64]*types.RefreshToken),
+		personalTokens: make(map[uint64]*types.PersonalToken),
+		todos:          make(map[uint64]*types.Todo),
+		denied:         make(map[string]time.Time),
+		twoFactor:      make(map[uint64]*types.TwoFactor),
+		recoveryCodes:  make(map[uint64]map[string]bool),
+		challenges:     make(map[uint64]*types.LoginChallenge),
+		attempts:       make(map[string]*types.LoginAttempt),
+		passwordResets: make(map[uint64]*types.PasswordReset),
+		emailChanges:   make(map[uint64]*types.EmailChange),
+		impersonations: make(map[uint64]*types.Impersonation),
+	}
+}
+
+var (
+	_ storage.TodoStore          = (*TodoStorage)(nil)
+	_ storage.TokenStore         = (*TokenStorage)(nil)
+	_ storage.PersonalTokenStore = (*PersonalTokenStorage)(nil)
+	_ storage.TwoFactorStore     = (*TwoFactorStorage)(nil)
+	_ storage.AttemptStore       = (*AttemptStorage)(nil)
+	_ storage.PasswordResetStore = (*PasswordResetStorage)(nil)
+	_ storage.EmailChangeStore   = (*EmailChangeStorage)(nil)
+	_ storage.ImpersonationStore = (*ImpersonationStorage)(nil)
+	_ storage.AuthEventStore     = (*AuthEventStorage)(nil)
+	_ storage.UserStore          = (*UserStorage)(nil)
+)
@@ -0,0 +1,25 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/iwajezhgf/todo-backend/storage/storetest"
+)
+
+func TestStores(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Stores {
+		mem := NewStorage()
+		return storetest.Stores{
+			Todos:          &TodoStorage{Storage: mem},
+			Tokens:         &TokenStorage{Storage: mem},
+			PersonalTokens: &PersonalTokenStorage{Storage: mem},
+			TwoFactor:      &TwoFactorStorage{Storage: mem},
+			Attempts:       &AttemptStorage{Storage: mem},
+			PasswordResets: &PasswordResetStorage{Storage: mem},
+			EmailChanges:   &EmailChangeStorage{Storage: mem},
+			Impersonations: &ImpersonationStorage{Storage: mem},
+			AuthEvents:     &AuthEventStorage{Storage: mem},
+			Users:          &UserStorage{Storage: mem},
+		}
+	})
+}
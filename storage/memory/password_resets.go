@@ -0,0 +1,74 @@
+package memory
+
+import (
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type PasswordResetStorage struct {
+	*Storage
+}
+
+func (s *PasswordResetStorage) Create(token string, userId uint64, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastPasswordResetID++
+	s.passwordResets[s.lastPasswordResetID] = &types.PasswordReset{
+		ID:        s.lastPasswordResetID,
+		TokenHash: storage.HashToken(token),
+		UserID:    userId,
+		Created:   time.Now().UTC(),
+		Expire:    expire,
+	}
+
+	return nil
+}
+
+func (s *PasswordResetStorage) GetByToken(token string) (*types.PasswordReset, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := storage.HashToken(token)
+	for _, r := range s.passwordResets {
+		if r.TokenHash == hash {
+			reset := *r
+			return &reset, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *PasswordResetStorage) Use(id, userId uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.passwordResets[id]
+	if !ok || r.UserID != userId || r.Used {
+		return false, nil
+	}
+
+	r.Used = true
+	for resetID, r := range s.passwordResets {
+		if r.UserID == userId && resetID != id {
+			delete(s.passwordResets, resetID)
+		}
+	}
+
+	return true, nil
+}
+
+func (s *PasswordResetStorage) CleanupExpiredTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, r := range s.passwordResets {
+		if r.Expire.Before(now) {
+			delete(s.passwordResets, id)
+		}
+	}
+}
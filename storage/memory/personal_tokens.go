@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type PersonalTokenStorage struct {
+	*Storage
+}
+
+func (s *PersonalTokenStorage) Create(token, name string, scopes []string, expire *time.Time, userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := storage.HashToken(token)
+	for _, t := range s.personalTokens {
+		if t.TokenHash == hash {
+			return errors.New("token already exists")
+		}
+	}
+
+	s.lastPersonalTokenID++
+	s.personalTokens[s.lastPersonalTokenID] = &types.PersonalToken{
+		ID:        s.lastPersonalTokenID,
+		TokenHash: hash,
+		Name:      name,
+		Scopes:    append([]string(nil), scopes...),
+		Created:   time.Now().UTC(),
+		Expire:    expire,
+		UserID:    userId,
+	}
+
+	return nil
+}
+
+func (s *PersonalTokenStorage) GetByToken(token string) (*types.PersonalToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := storage.HashToken(token)
+	for _, t := range s.personalTokens {
+		if t.TokenHash == hash {
+			pat := *t
+			return &pat, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *PersonalTokenStorage) GetByUserId(id, userId uint64) (*types.PersonalToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.personalTokens[id]
+	if !ok || t.UserID != userId {
+		return nil, storage.ErrNotFound
+	}
+
+	pat := *t
+	return &pat, nil
+}
+
+func (s *PersonalTokenStorage) GetAllByUser(userId uint64) ([]types.PersonalToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]types.PersonalToken, 0)
+	for _, t := range s.personalTokens {
+		if t.UserID == userId {
+			tokens = append(tokens, *t)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].Created.Equal(tokens[j].Created) {
+			return tokens[i].ID > tokens[j].ID
+		}
+		return tokens[i].Created.After(tokens[j].Created)
+	})
+
+	return tokens, nil
+}
+
+func (s *PersonalTokenStorage) Touch(id uint64, lastUsed time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.personalTokens[id]; ok {
+		t.LastUsed = &lastUsed
+	}
+
+	return nil
+}
+
+func (s *PersonalTokenStorage) Delete(id, userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.personalTokens[id]; ok && t.UserID == userId {
+		delete(s.personalTokens, id)
+	}
+
+	return nil
+}
+
+func (s *PersonalTokenStorage) DeleteByUser(userId uint64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, t := range s.personalTokens {
+		if t.UserID == userId {
+			delete(s.personalTokens, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *PersonalTokenStorage) CleanupExpiredTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, t := range s.personalTokens {
+		if t.Expire != nil && t.Expire.Before(now) {
+			delete(s.personalTokens, id)
+		}
+	}
+}
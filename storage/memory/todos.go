@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type TodoStorage struct {
+	*Storage
+}
+
+func (s *TodoStorage) Create(title, note string, expire time.Time, userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastTodoID++
+	s.todos[s.lastTodoID] = &types.Todo{
+		ID:      s.lastTodoID,
+		Title:   title,
+		Note:    note,
+		Created: time.Now().UTC(),
+		Expire:  expire.UTC(),
+		Status:  "active",
+		UserID:  userId,
+	}
+
+	return nil
+}
+
+func (s *TodoStorage) GetByUserId(id, userId uint64) (*types.Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.todos[id]
+	if !ok || t.UserID != userId {
+		return nil, storage.ErrNotFound
+	}
+
+	todo := *t
+	return &todo, nil
+}
+
+func (s *TodoStorage) GetTodosByPage(userId uint64, page, limit int) (*types.TodoData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	userTodos := s.userTodos(userId)
+
+	todos := make([]types.Todo, 0)
+	if offset := (page - 1) * limit; offset >= 0 && offset < len(userTodos) {
+		end := offset + limit
+		if end > len(userTodos) {
+			end = len(userTodos)
+		}
+		todos = append(todos, userTodos[offset:end]...)
+	}
+
+	data := types.TodoData{
+		Items:      todos,
+		Pagination: storage.NewPagination(page, limit, len(userTodos)),
+	}
+
+	return &data, nil
+}
+
+func (s *TodoStorage) GetAllByUser(userId uint64) ([]types.Todo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.userTodos(userId), nil
+}
+
+func (s *TodoStorage) Edit(title, note string, expire time.Time, id, userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.todos[id]; ok && t.UserID == userId {
+		t.Title = title
+		t.Note = note
+		t.Expire = expire.UTC()
+	}
+
+	return nil
+}
+
+func (s *TodoStorage) EditStatus(id, userId uint64, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.todos[id]; ok && t.UserID == userId {
+		t.Status = status
+	}
+
+	return nil
+}
+
+func (s *TodoStorage) Delete(id uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.todos, id)
+}
+
+func (s *TodoStorage) CheckTodoStatus() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for _, t := range s.todos {
+		if t.Status != "completed" && now.After(t.Expire) {
+			t.Status = "overdue"
+		}
+	}
+}
+
+func (s *TodoStorage) RecomputeStatus() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+
+	var changed int64
+	for _, t := range s.todos {
+		switch {
+		case t.Status == "active" && now.After(t.Expire):
+			t.Status = "overdue"
+		case t.Status == "overdue" && !now.After(t.Expire):
+			t.Status = "active"
+		default:
+			continue
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// userTodos returns copies of the user's todos ordered by created DESC like
+// the SQL backends. The caller must hold the lock.
+func (s *Storage) userTodos(userId uint64) []types.Todo {
+	todos := make([]types.Todo, 0)
+	for _, t := range s.todos {
+		if t.UserID == userId {
+			todos = append(todos, *t)
+		}
+	}
+
+	sort.Slice(todos, func(i, j int) bool {
+		if todos[i].Created.Equal(todos[j].Created) {
+			return todos[i].ID > todos[j].ID
+		}
+		return todos[i].Created.After(todos[j].Created)
+	})
+
+	return todos
+}
@@ -0,0 +1,305 @@
+package memory
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type TokenStorage struct {
+	*Storage
+}
+
+func (s *TokenStorage) Create(token string, userId uint64, expire time.Time, userAgent, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokenByValue(token) != nil {
+		return errors.New("token already exists")
+	}
+
+	now := time.Now().UTC()
+	s.lastTokenID++
+	s.tokens[s.lastTokenID] = &types.Token{
+		ID:        s.lastTokenID,
+		TokenHash: storage.HashToken(token),
+		UserAgent: userAgent,
+		IP:        ip,
+		Created:   now,
+		LastUsed:  now,
+		Expire:    expire,
+		UserID:    userId,
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) CreateWithRefresh(
+	token, refreshToken string, userId uint64, expire, sessionExpire time.Time, userAgent, ip string,
+) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tokenByValue(token) != nil {
+		return errors.New("token already exists")
+	}
+
+	now := time.Now().UTC()
+	s.lastTokenID++
+	s.tokens[s.lastTokenID] = &types.Token{
+		ID:            s.lastTokenID,
+		TokenHash:     storage.HashToken(token),
+		UserAgent:     userAgent,
+		IP:            ip,
+		Created:       now,
+		LastUsed:      now,
+		Expire:        expire,
+		SessionExpire: &sessionExpire,
+		UserID:        userId,
+	}
+	s.addRefreshToken(refreshToken, s.lastTokenID, userId, now)
+
+	return nil
+}
+
+func (s *TokenStorage) GetByToken(token string) (*types.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t := s.tokenByValue(token)
+	if t == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	tok := *t
+	return &tok, nil
+}
+
+func (s *TokenStorage) GetByUserId(id, userId uint64) (*types.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tokens[id]
+	if !ok || t.UserID != userId {
+		return nil, storage.ErrNotFound
+	}
+
+	tok := *t
+	return &tok, nil
+}
+
+func (s *TokenStorage) GetAllByUser(userId uint64) ([]types.Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tokens := make([]types.Token, 0)
+	for _, t := range s.tokens {
+		if t.UserID == userId {
+			tokens = append(tokens, *t)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].LastUsed.Equal(tokens[j].LastUsed) {
+			return tokens[i].ID > tokens[j].ID
+		}
+		return tokens[i].LastUsed.After(tokens[j].LastUsed)
+	})
+
+	return tokens, nil
+}
+
+func (s *TokenStorage) GetRefresh(refreshToken string) (*types.RefreshToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := storage.HashToken(refreshToken)
+	for _, rt := range s.refreshTokens {
+		if rt.TokenHash == hash {
+			refresh := *rt
+			return &refresh, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *TokenStorage) Rotate(
+	refreshId, sessionId uint64, token, refreshToken string, expire, sessionExpire time.Time,
+) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt, ok := s.refreshTokens[refreshId]
+	if !ok || rt.Used {
+		return false, nil
+	}
+	t, ok := s.tokens[sessionId]
+	if !ok {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	rt.Used = true
+	t.TokenHash = storage.HashToken(token)
+	t.LastUsed = now
+	t.Expire = expire
+	t.SessionExpire = &sessionExpire
+	s.addRefreshToken(refreshToken, t.ID, t.UserID, now)
+
+	return true, nil
+}
+
+func (s *TokenStorage) Touch(id uint64, lastUsed, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[id]; ok {
+		t.LastUsed = lastUsed
+		t.Expire = expire
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) EditName(id, userId uint64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[id]; ok && t.UserID == userId {
+		t.Name = name
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) Delete(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t := s.tokenByValue(token); t != nil {
+		s.deleteToken(t.ID)
+	}
+}
+
+func (s *TokenStorage) DeleteById(id, userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[id]; ok && t.UserID == userId {
+		s.deleteToken(id)
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) DeleteByUser(userId uint64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, t := range s.tokens {
+		if t.UserID == userId {
+			s.deleteToken(id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *TokenStorage) DeleteOthers(userId, keepId uint64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, t := range s.tokens {
+		if t.UserID == userId && id != keepId {
+			s.deleteToken(id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *TokenStorage) Deny(tokenHash string, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.denied[tokenHash] = expire
+
+	return nil
+}
+
+func (s *TokenStorage) GetDenied() (map[string]time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now().UTC()
+	denied := make(map[string]time.Time)
+	for hash, expire := range s.denied {
+		if !expire.Before(now) {
+			denied[hash] = expire
+		}
+	}
+
+	return denied, nil
+}
+
+func (s *TokenStorage) CleanupExpiredTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, t := range s.tokens {
+		if t.Expire.Before(now) && (t.SessionExpire == nil || t.SessionExpire.Before(now)) {
+			s.deleteToken(id)
+		}
+	}
+	for hash, expire := range s.denied {
+		if expire.Before(now) {
+			delete(s.denied, hash)
+		}
+	}
+}
+
+// addRefreshToken stores a new unused refresh token for the session.
+// The caller must hold the lock.
+func (s *Storage) addRefreshToken(refreshToken string, sessionId, userId uint64, created time.Time) {
+	s.lastRefreshID++
+	s.refreshTokens[s.lastRefreshID] = &types.RefreshToken{
+		ID:        s.lastRefreshID,
+		TokenHash: storage.HashToken(refreshToken),
+		SessionID: sessionId,
+		UserID:    userId,
+		Created:   created,
+	}
+}
+
+// deleteToken removes a token and the refresh tokens of its session like the
+// ON DELETE CASCADE of the SQL backends. The caller must hold the lock.
+func (s *Storage) deleteToken(id uint64) {
+	delete(s.tokens, id)
+	for refreshId, rt := range s.refreshTokens {
+		if rt.SessionID == id {
+			delete(s.refreshTokens, refreshId)
+		}
+	}
+}
+
+// tokenByValue returns the token record for the given bearer value.
+// The caller must hold the lock.
+func (s *Storage) tokenByValue(token string) *types.Token {
+	hash := storage.HashToken(token)
+	for _, t := range s.tokens {
+		if t.TokenHash == hash {
+			return t
+		}
+	}
+
+	return nil
+}
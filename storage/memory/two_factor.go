@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"errors"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type TwoFactorStorage struct {
+	*Storage
+}
+
+func (s *TwoFactorStorage) SetSecret(userId uint64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tf, ok := s.twoFactor[userId]; ok && tf.Enabled {
+		return errors.New("two-factor authentication already enabled")
+	}
+
+	s.twoFactor[userId] = &types.TwoFactor{
+		UserID:  userId,
+		Secret:  secret,
+		Created: time.Now().UTC(),
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) Get(userId uint64) (*types.TwoFactor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tf, ok := s.twoFactor[userId]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	twoFactor := *tf
+	return &twoFactor, nil
+}
+
+func (s *TwoFactorStorage) Enable(userId uint64, step int64, recoveryCodes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.twoFactor[userId]
+	if !ok || tf.Enabled {
+		return storage.ErrNotFound
+	}
+
+	tf.Enabled = true
+	tf.LastStep = step
+
+	codes := make(map[string]bool, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		codes[storage.HashToken(code)] = false
+	}
+	s.recoveryCodes[userId] = codes
+
+	return nil
+}
+
+func (s *TwoFactorStorage) UseStep(userId uint64, step int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tf, ok := s.twoFactor[userId]
+	if !ok || tf.LastStep >= step {
+		return false, nil
+	}
+
+	tf.LastStep = step
+	return true, nil
+}
+
+func (s *TwoFactorStorage) UseRecoveryCode(userId uint64, code string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hash := storage.HashToken(code)
+	used, ok := s.recoveryCodes[userId][hash]
+	if !ok || used {
+		return false, nil
+	}
+
+	s.recoveryCodes[userId][hash] = true
+	return true, nil
+}
+
+func (s *TwoFactorStorage) CountRecoveryCodes(userId uint64) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	count := 0
+	for _, used := range s.recoveryCodes[userId] {
+		if !used {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// Disable removes the secret, the recovery codes and pending login challenges.
+func (s *TwoFactorStorage) Disable(userId uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteTwoFactor(userId)
+
+	return nil
+}
+
+// deleteTwoFactor removes everything two-factor related of the user. The
+// caller must hold the lock.
+func (s *Storage) deleteTwoFactor(userId uint64) {
+	for id, c := range s.challenges {
+		if c.UserID == userId {
+			delete(s.challenges, id)
+		}
+	}
+	delete(s.recoveryCodes, userId)
+	delete(s.twoFactor, userId)
+}
+
+func (s *TwoFactorStorage) CreateChallenge(token string, userId uint64, expire time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastChallengeID++
+	s.challenges[s.lastChallengeID] = &types.LoginChallenge{
+		ID:        s.lastChallengeID,
+		TokenHash: storage.HashToken(token),
+		UserID:    userId,
+		Expire:    expire,
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) GetChallenge(token string) (*types.LoginChallenge, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	hash := storage.HashToken(token)
+	for _, c := range s.challenges {
+		if c.TokenHash == hash {
+			challenge := *c
+			return &challenge, nil
+		}
+	}
+
+	return nil, storage.ErrNotFound
+}
+
+func (s *TwoFactorStorage) FailChallenge(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.challenges[id]; ok {
+		c.Attempts++
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) DeleteChallenge(id uint64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.challenges[id]; !ok {
+		return false, nil
+	}
+
+	delete(s.challenges, id)
+	return true, nil
+}
+
+func (s *TwoFactorStorage) CleanupExpiredTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	for id, c := range s.challenges {
+		if c.Expire.Before(now) {
+			delete(s.challenges, id)
+		}
+	}
+}
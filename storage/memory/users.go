@@ -0,0 +1,327 @@
+package memory
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type UserStorage struct {
+	*Storage
+}
+
+func (s *UserStorage) Create(email string, password []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userByEmail(email) != nil {
+		return storage.ErrDuplicate
+	}
+
+	s.lastUserID++
+	s.users[s.lastUserID] = &types.User{
+		ID:       s.lastUserID,
+		Email:    email,
+		Password: append([]byte(nil), password...),
+		Role:     types.RoleUser,
+		Profile:  storage.DefaultProfile,
+	}
+
+	return nil
+}
+
+func (s *UserStorage) GetById(id uint64) (*types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+
+	user := *u
+	return &user, nil
+}
+
+func (s *UserStorage) GetByEmail(email string) (*types.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u := s.userByEmail(email)
+	if u == nil {
+		return nil, storage.ErrNotFound
+	}
+
+	user := *u
+	return &user, nil
+}
+
+func (s *UserStorage) EditPassword(userId uint64, password []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok {
+		u.Password = append([]byte(nil), password...)
+	}
+
+	return nil
+}
+
+func (s *UserStorage) EditProfile(userId uint64, p types.Profile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok {
+		u.Profile = p
+	}
+
+	return nil
+}
+
+func (s *UserStorage) SetRole(userId uint64, role string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok {
+		u.Role = role
+	}
+
+	return nil
+}
+
+func (s *UserStorage) SetDisabled(userId uint64, at *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok {
+		u.DisabledAt = at
+	}
+
+	return nil
+}
+
+func (s *UserStorage) Search(query string, page, limit int) (*types.UserData, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query = strings.ToLower(query)
+	matches := make([]types.User, 0)
+	for _, u := range s.users {
+		if strings.Contains(strings.ToLower(u.Email), query) ||
+			strings.Contains(strings.ToLower(u.DisplayName), query) {
+			matches = append(matches, *u)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	users := make([]types.User, 0)
+	if offset := (page - 1) * limit; offset >= 0 && offset < len(matches) {
+		end := offset + limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+		users = append(users, matches[offset:end]...)
+	}
+
+	return &types.UserData{
+		Items:      users,
+		Pagination: storage.NewPagination(page, limit, len(matches)),
+	}, nil
+}
+
+func (s *UserStorage) Usage(userId uint64) (*types.Usage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var u types.Usage
+	for _, t := range s.todos {
+		if t.UserID == userId {
+			u.Todos++
+		}
+	}
+	for _, t := range s.tokens {
+		if t.UserID == userId {
+			u.Sessions++
+		}
+	}
+	for _, t := range s.personalTokens {
+		if t.UserID == userId {
+			u.PersonalTokens++
+		}
+	}
+
+	return &u, nil
+}
+
+func (s *UserStorage) TotalUsage() (*types.TotalUsage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u := types.TotalUsage{
+		Users: len(s.users),
+		Usage: types.Usage{
+			Todos:          len(s.todos),
+			Sessions:       len(s.tokens),
+			PersonalTokens: len(s.personalTokens),
+		},
+	}
+	for _, user := range s.users {
+		if user.DisabledAt != nil {
+			u.DisabledUsers++
+		}
+	}
+
+	return &u, nil
+}
+
+func (s *UserStorage) CountEnabled(role string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := 0
+	for _, u := range s.users {
+		if u.Role == role && u.DisabledAt == nil {
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (s *UserStorage) Verify(userId uint64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok && u.VerifiedAt == nil {
+		u.VerifiedAt = &at
+	}
+
+	return nil
+}
+
+func (s *UserStorage) EditEmail(userId uint64, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if other := s.userByEmail(email); other != nil && other.ID != userId {
+		return storage.ErrDuplicate
+	}
+
+	if u, ok := s.users[userId]; ok {
+		now := time.Now().UTC()
+		u.Email = email
+		u.VerifiedAt = &now
+	}
+
+	return nil
+}
+
+func (s *UserStorage) ScheduleDeletion(userId uint64, at *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u, ok := s.users[userId]; ok {
+		u.DeleteAfter = at
+	}
+
+	return nil
+}
+
+func (s *UserStorage) PurgeDeleted() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	var deleted int64
+	for id, u := range s.users {
+		if u.DeleteAfter != nil && u.DeleteAfter.Before(now) {
+			s.deleteUser(id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// Delete removes the user together with all of their todos and tokens, and
+// detaches them from the security log and the impersonation audit.
+func (s *UserStorage) Delete(id uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteUser(id)
+
+	return nil
+}
+
+// deleteUser removes the user and everything they own. The caller must hold
+// the lock.
+func (s *Storage) deleteUser(id uint64) {
+	for todoID, t := range s.todos {
+		if t.UserID == id {
+			delete(s.todos, todoID)
+		}
+	}
+	for tokenID, t := range s.tokens {
+		if t.UserID == id {
+			s.deleteToken(tokenID)
+		}
+	}
+	for tokenID, t := range s.personalTokens {
+		if t.UserID == id {
+			delete(s.personalTokens, tokenID)
+		}
+	}
+	for changeID, c := range s.emailChanges {
+		if c.UserID == id {
+			delete(s.emailChanges, changeID)
+		}
+	}
+	for resetID, r := range s.passwordResets {
+		if r.UserID == id {
+			delete(s.passwordResets, resetID)
+		}
+	}
+	s.deleteTwoFactor(id)
+
+	// The logs are kept, but no longer point to the user.
+	for i := range s.authEvents {
+		if e := &s.authEvents[i]; e.UserID != nil && *e.UserID == id {
+			e.UserID, e.Email, e.IP, e.UserAgent = nil, "", "", ""
+		}
+	}
+	for i := range s.impersonationAudit {
+		e := &s.impersonationAudit[i]
+		if e.UserID == id {
+			e.UserID = 0
+		}
+		if e.AdminID == id {
+			e.AdminID = 0
+		}
+	}
+	for _, imp := range s.impersonations {
+		if imp.UserID == id {
+			imp.UserID, imp.Reason = 0, ""
+		}
+		if imp.AdminID == id {
+			imp.AdminID = 0
+		}
+	}
+
+	delete(s.users, id)
+}
+
+// userByEmail matches emails case-insensitively like the unique email
+// column of the SQL backends. The caller must hold the lock.
+func (s *Storage) userByEmail(email string) *types.User {
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) {
+			return u
+		}
+	}
+
+	return nil
+}
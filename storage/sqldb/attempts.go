@@ -0,0 +1,97 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type AttemptStorage struct {
+	*Storage
+}
+
+func (s *AttemptStorage) Get(key string) (*types.LoginAttempt, error) {
+	var a types.LoginAttempt
+	var lockedUntil sql.NullTime
+	err := s.queryRow(
+		"SELECT attempt_key, failures, locked_until, expire FROM login_attempts WHERE attempt_key = ?", key,
+	).Scan(&a.Key, &a.Failures, &lockedUntil, &a.Expire)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+	if lockedUntil.Valid {
+		a.LockedUntil = &lockedUntil.Time
+	}
+
+	return &a, nil
+}
+
+func (s *AttemptStorage) Fail(key string, expire time.Time) (int, error) {
+	const update = "UPDATE login_attempts SET failures = CASE WHEN expire < ? THEN 1 ELSE failures + 1 END, expire = ? WHERE attempt_key = ?"
+
+	now := time.Now().UTC()
+	res, err := s.exec(update, now, expire, key)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		_, err = s.exec("INSERT INTO login_attempts (attempt_key, failures, expire) VALUES (?, 1, ?)", key, expire)
+		if err != nil {
+			// Another instance inserted the row first.
+			_, err = s.exec(update, now, expire, key)
+		}
+		if err != nil {
+			log.Println("db error: ", err)
+			return 0, errors.New("db error")
+		}
+	}
+
+	var failures int
+	err = s.queryRow("SELECT failures FROM login_attempts WHERE attempt_key = ?", key).Scan(&failures)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	return failures, nil
+}
+
+func (s *AttemptStorage) Lock(key string, until time.Time) error {
+	_, err := s.exec("UPDATE login_attempts SET locked_until = ? WHERE attempt_key = ?", until, key)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *AttemptStorage) Reset(key string) error {
+	_, err := s.exec("DELETE FROM login_attempts WHERE attempt_key = ?", key)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *AttemptStorage) CleanupExpiredTokens() {
+	now := time.Now().UTC()
+	_, err := s.exec(
+		"DELETE FROM login_attempts WHERE expire < ? AND (locked_until IS NULL OR locked_until < ?)", now, now,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
@@ -0,0 +1,133 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type AuthEventStorage struct {
+	*Storage
+}
+
+func (s *AuthEventStorage) Record(e types.AuthEvent) error {
+	var userId sql.NullInt64
+	if e.UserID != nil {
+		userId = sql.NullInt64{Int64: int64(*e.UserID), Valid: true}
+	}
+
+	_, err := s.exec(
+		"INSERT INTO auth_events (user_id, email, type, outcome, reason, ip, user_agent, created) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userId, e.Email, e.Type, e.Outcome, e.Reason, e.IP, e.UserAgent, e.Created,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *AuthEventStorage) Search(f types.AuthEventFilter, page, limit int) (*types.AuthEventData, error) {
+	var conds []string
+	var args []interface{}
+	if f.UserID != 0 {
+		conds = append(conds, "user_id = ?")
+		args = append(args, f.UserID)
+	}
+	if f.Email != "" {
+		conds = append(conds, "LOWER(email) = ?")
+		args = append(args, strings.ToLower(f.Email))
+	}
+	if f.Type != "" {
+		conds = append(conds, "type = ?")
+		args = append(args, f.Type)
+	}
+	if f.Outcome != "" {
+		conds = append(conds, "outcome = ?")
+		args = append(args, f.Outcome)
+	}
+	if f.IP != "" {
+		conds = append(conds, "ip = ?")
+		args = append(args, f.IP)
+	}
+	if f.Since != nil {
+		conds = append(conds, "created >= ?")
+		args = append(args, f.Since.UTC())
+	}
+	if f.Until != nil {
+		conds = append(conds, "created < ?")
+		args = append(args, f.Until.UTC())
+	}
+
+	where := " FROM auth_events"
+	if len(conds) > 0 {
+		where += " WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var totalRecords int
+	err := s.queryRow("SELECT COUNT(*)"+where, args...).Scan(&totalRecords)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	rows, err := s.query(
+		"SELECT id, user_id, email, type, outcome, reason, ip, user_agent, created"+where+
+			" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, limit, (page-1)*limit)...,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	events := make([]types.AuthEvent, 0)
+	for rows.Next() {
+		var e types.AuthEvent
+		var userId sql.NullInt64
+		err = rows.Scan(&e.ID, &userId, &e.Email, &e.Type, &e.Outcome, &e.Reason, &e.IP, &e.UserAgent, &e.Created)
+		if err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		if userId.Valid {
+			id := uint64(userId.Int64)
+			e.UserID = &id
+		}
+		e.Created = e.Created.UTC()
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return &types.AuthEventData{
+		Items:      events,
+		Pagination: storage.NewPagination(page, limit, totalRecords),
+	}, nil
+}
+
+func (s *AuthEventStorage) DeleteBefore(t time.Time) (int64, error) {
+	res, err := s.exec("DELETE FROM auth_events WHERE created < ?", t)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	return n, nil
+}
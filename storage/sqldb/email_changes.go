@@ -0,0 +1,70 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type EmailChangeStorage struct {
+	*Storage
+}
+
+func (s *EmailChangeStorage) Create(
+	token, kind string, userId uint64, oldEmail, newEmail string, expire time.Time,
+) error {
+	_, err := s.exec(
+		"INSERT INTO email_changes (token_hash, kind, user_id, old_email, new_email, created, expire, used) VALUES (?, ?, ?, ?, ?, ?, ?, FALSE)",
+		storage.HashToken(token), kind, userId, oldEmail, newEmail, time.Now().UTC(), expire,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *EmailChangeStorage) GetByToken(token string) (*types.EmailChange, error) {
+	var c types.EmailChange
+	err := s.queryRow(
+		"SELECT id, token_hash, kind, user_id, old_email, new_email, created, expire, used FROM email_changes WHERE token_hash = ?",
+		storage.HashToken(token),
+	).Scan(&c.ID, &c.TokenHash, &c.Kind, &c.UserID, &c.OldEmail, &c.NewEmail, &c.Created, &c.Expire, &c.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get email change: %w", err)
+	}
+
+	return &c, nil
+}
+
+func (s *EmailChangeStorage) Use(id uint64) (bool, error) {
+	res, err := s.exec("UPDATE email_changes SET used = TRUE WHERE id = ? AND used = FALSE", id)
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	return n > 0, nil
+}
+
+func (s *EmailChangeStorage) CleanupExpiredTokens() {
+	_, err := s.exec("DELETE FROM email_changes WHERE expire < ?", time.Now().UTC())
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
@@ -0,0 +1,154 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+const impersonationColumns = "id, token_hash, admin_id, user_id, reason, created, expire, ended"
+
+type ImpersonationStorage struct {
+	*Storage
+}
+
+func (s *ImpersonationStorage) Create(token string, adminId, userId uint64, reason string, expire time.Time) error {
+	_, err := s.exec(
+		"INSERT INTO impersonations (token_hash, admin_id, user_id, reason, created, expire) VALUES (?, ?, ?, ?, ?, ?)",
+		storage.HashToken(token), adminId, userId, reason, time.Now().UTC(), expire,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *ImpersonationStorage) GetByToken(token string) (*types.Impersonation, error) {
+	return s.get("token_hash = ?", storage.HashToken(token))
+}
+
+func (s *ImpersonationStorage) GetById(id uint64) (*types.Impersonation, error) {
+	return s.get("id = ?", id)
+}
+
+func (s *ImpersonationStorage) get(where string, arg interface{}) (*types.Impersonation, error) {
+	imp, err := scanImpersonation(s.queryRow("SELECT "+impersonationColumns+" FROM impersonations WHERE "+where, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get impersonation: %w", err)
+	}
+
+	return imp, nil
+}
+
+func (s *ImpersonationStorage) GetActiveByUser(userId uint64, now time.Time) ([]types.Impersonation, error) {
+	rows, err := s.query(
+		"SELECT "+impersonationColumns+" FROM impersonations "+
+			"WHERE (admin_id = ? OR user_id = ?) AND ended IS NULL AND expire > ? ORDER BY id",
+		userId, userId, now,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	imps := make([]types.Impersonation, 0)
+	for rows.Next() {
+		imp, err := scanImpersonation(rows)
+		if err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		imps = append(imps, *imp)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return imps, nil
+}
+
+func scanImpersonation(row scanner) (*types.Impersonation, error) {
+	var imp types.Impersonation
+	var ended sql.NullTime
+	err := row.Scan(&imp.ID, &imp.TokenHash, &imp.AdminID, &imp.UserID, &imp.Reason, &imp.Created, &imp.Expire, &ended)
+	if err != nil {
+		return nil, err
+	}
+	if ended.Valid {
+		imp.Ended = &ended.Time
+	}
+
+	return &imp, nil
+}
+
+func (s *ImpersonationStorage) End(id uint64, at time.Time) (bool, error) {
+	res, err := s.exec("UPDATE impersonations SET ended = ? WHERE id = ? AND ended IS NULL", at, id)
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	return n == 1, nil
+}
+
+func (s *ImpersonationStorage) Record(e types.ImpersonationAudit) error {
+	_, err := s.exec(
+		"INSERT INTO impersonation_audit (impersonation_id, admin_id, user_id, action, method, path, status, created) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		e.ImpersonationID, e.AdminID, e.UserID, e.Action, e.Method, e.Path, e.Status, e.Created,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *ImpersonationStorage) GetAudit(impersonationId uint64) ([]types.ImpersonationAudit, error) {
+	rows, err := s.query(
+		"SELECT id, impersonation_id, admin_id, user_id, action, method, path, status, created "+
+			"FROM impersonation_audit WHERE impersonation_id = ? ORDER BY id",
+		impersonationId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	entries := make([]types.ImpersonationAudit, 0)
+	for rows.Next() {
+		var e types.ImpersonationAudit
+		err = rows.Scan(&e.ID, &e.ImpersonationID, &e.AdminID, &e.UserID, &e.Action, &e.Method, &e.Path, &e.Status, &e.Created)
+		if err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		entries = append(entries, e)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return entries, nil
+}
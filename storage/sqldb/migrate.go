@@ -0,0 +1,367 @@
+package sqldb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Migration struct {
+	Version string
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// LoadMigrations reads the migrations for driver from fsys, which is expected
+// to hold one directory per driver, and returns them sorted by version.
+func LoadMigrations(fsys fs.FS, driver string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(driver, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*Migration)
+	hasUp := make(map[string]bool)
+	for _, file := range files {
+		base := path.Base(file)
+
+		var direction string
+		switch {
+		case strings.HasSuffix(base, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(base, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		version, name, ok := strings.Cut(strings.TrimSuffix(base, "."+direction+".sql"), "_")
+		if !ok || version == "" {
+			return nil, fmt.Errorf("invalid migration file name %q", base)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(content)
+			hasUp[version] = true
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if !hasUp[m.Version] {
+			return nil, fmt.Errorf("migration %s_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// MigrateUp applies every migration that has not been applied yet, in order,
+// and returns the ones it applied.
+func (s *Storage) MigrateUp(migrations []Migration) ([]Migration, error) {
+	unlock, err := s.lockMigrations()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		err = s.runMigration(m.Up, func(tx *sql.Tx) error {
+			_, err := tx.Exec(
+				s.rebind("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)"),
+				m.Version, time.Now().UTC(),
+			)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// MigrateDown rolls back the last n applied migrations, newest first,
+// and returns the ones it rolled back.
+func (s *Storage) MigrateDown(migrations []Migration, n int) ([]Migration, error) {
+	unlock, err := s.lockMigrations()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for i := len(migrations) - 1; i >= 0 && len(done) < n; i-- {
+		m := migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("migration %s_%s has no down file", m.Version, m.Name)
+		}
+
+		err = s.runMigration(m.Down, func(tx *sql.Tx) error {
+			_, err := tx.Exec(s.rebind("DELETE FROM schema_migrations WHERE version = ?"), m.Version)
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %s_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it, for databases whose tables were created before the
+// migration runner. It returns the ones it recorded.
+func (s *Storage) Baseline(migrations []Migration, version string) ([]Migration, error) {
+	known := false
+	for _, m := range migrations {
+		if m.Version == version {
+			known = true
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown migration version %q", version)
+	}
+
+	unlock, err := s.lockMigrations()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]Migration, 0)
+	for _, m := range migrations {
+		if m.Version > version {
+			break
+		}
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		_, err = s.exec("INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)", m.Version, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migration %s_%s: %w", m.Version, m.Name, err)
+		}
+		done = append(done, m)
+	}
+
+	return done, nil
+}
+
+func (s *Storage) MigrationStatus(migrations []Migration) ([]MigrationStatus, error) {
+	applied, err := s.appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		appliedAt, ok := applied[m.Version]
+		status = append(status, MigrationStatus{Migration: m, Applied: ok, AppliedAt: appliedAt})
+	}
+
+	return status, nil
+}
+
+// migrationLockName names the MySQL lock held while migrating, and
+// migrationLockKey the PostgreSQL one.
+const (
+	migrationLockName       = "todo-backend:schema_migrations"
+	migrationLockKey  int64 = 0x746f646f6d6967 // "todomig"
+)
+
+// lockMigrations takes a lock on the whole database so that servers started
+// together with auto_migrate apply migrations one after the other, and
+// returns the function that releases it. The lock belongs to the connection
+// it was taken on, which is kept out of the pool until then. SQLite databases
+// are not shared between servers and get no lock.
+func (s *Storage) lockMigrations() (func(), error) {
+	var lock, unlock string
+	var key interface{}
+	switch s.Driver {
+	case MySQL:
+		// GET_LOCK returns 1 once it has the lock; a negative timeout waits
+		// for as long as it takes.
+		lock, unlock, key = "SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)", migrationLockName
+	case Postgres:
+		lock, unlock, key = "SELECT 1 FROM pg_advisory_lock($1)", "SELECT pg_advisory_unlock($1)", migrationLockKey
+	default:
+		return func() {}, nil
+	}
+
+	ctx := context.Background()
+	conn, err := s.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked sql.NullInt64
+	err = conn.QueryRowContext(ctx, lock, key).Scan(&locked)
+	if err == nil && locked.Int64 != 1 {
+		err = errors.New("not granted")
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("migration lock: %w", err)
+	}
+
+	return func() {
+		var released interface{}
+		_ = conn.QueryRowContext(ctx, unlock, key).Scan(&released)
+		conn.Close()
+	}, nil
+}
+
+func (s *Storage) appliedMigrations() (map[string]time.Time, error) {
+	var ddl string
+	switch s.Driver {
+	case Postgres:
+		ddl = "CREATE TABLE IF NOT EXISTS schema_migrations (version VARCHAR(255) NOT NULL PRIMARY KEY, applied_at TIMESTAMPTZ NOT NULL)"
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS schema_migrations (version VARCHAR(255) NOT NULL PRIMARY KEY, applied_at DATETIME NOT NULL)"
+	}
+	if _, err := s.exec(ddl); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[string]time.Time)
+	for rows.Next() {
+		var version string
+		var appliedAt time.Time
+		if err = rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// runMigration executes every statement of script and then record inside one
+// transaction. MySQL commits DDL implicitly, so there a failed migration can
+// leave the statements before the failing one applied.
+func (s *Storage) runMigration(script string, record func(tx *sql.Tx) error) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range splitStatements(script) {
+		if _, err = tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	if err = record(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a script on semicolons that are not inside quotes
+// or comments, since not every driver accepts several statements per Exec.
+func splitStatements(script string) []string {
+	var (
+		stmts   []string
+		current strings.Builder
+		quote   rune
+		comment bool
+	)
+	flush := func() {
+		if stmt := strings.TrimSpace(current.String()); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+		current.Reset()
+	}
+
+	runes := []rune(script)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case comment:
+			if r == '\n' {
+				comment = false
+				current.WriteRune(r)
+			}
+			continue
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			comment = true
+			continue
+		case r == ';':
+			flush()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	flush()
+
+	return stmts
+}
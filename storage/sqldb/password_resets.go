@@ -0,0 +1,81 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type PasswordResetStorage struct {
+	*Storage
+}
+
+func (s *PasswordResetStorage) Create(token string, userId uint64, expire time.Time) error {
+	_, err := s.exec(
+		"INSERT INTO password_resets (token_hash, user_id, created, expire, used) VALUES (?, ?, ?, ?, FALSE)",
+		storage.HashToken(token), userId, time.Now().UTC(), expire,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *PasswordResetStorage) GetByToken(token string) (*types.PasswordReset, error) {
+	var r types.PasswordReset
+	err := s.queryRow(
+		"SELECT id, token_hash, user_id, created, expire, used FROM password_resets WHERE token_hash = ?",
+		storage.HashToken(token),
+	).Scan(&r.ID, &r.TokenHash, &r.UserID, &r.Created, &r.Expire, &r.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get password reset: %w", err)
+	}
+
+	return &r, nil
+}
+
+func (s *PasswordResetStorage) Use(id, userId uint64) (bool, error) {
+	used := false
+	err := s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			s.rebind("UPDATE password_resets SET used = TRUE WHERE id = ? AND user_id = ? AND used = FALSE"), id, userId,
+		)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind("DELETE FROM password_resets WHERE user_id = ? AND id != ?"), userId, id)
+		if err != nil {
+			return err
+		}
+
+		used = true
+		return nil
+	})
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	return used, nil
+}
+
+func (s *PasswordResetStorage) CleanupExpiredTokens() {
+	_, err := s.exec("DELETE FROM password_resets WHERE expire < ?", time.Now().UTC())
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
@@ -0,0 +1,144 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+const personalTokenColumns = "id, token_hash, name, scopes, created, last_used, expire, user_id"
+
+type PersonalTokenStorage struct {
+	*Storage
+}
+
+func (s *PersonalTokenStorage) Create(token, name string, scopes []string, expire *time.Time, userId uint64) error {
+	_, err := s.exec(
+		"INSERT INTO personal_tokens (token_hash, name, scopes, created, expire, user_id) VALUES (?, ?, ?, ?, ?, ?)",
+		storage.HashToken(token), name, strings.Join(scopes, " "), time.Now().UTC(), expire, userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *PersonalTokenStorage) GetByToken(token string) (*types.PersonalToken, error) {
+	t, err := scanPersonalToken(s.queryRow(
+		"SELECT "+personalTokenColumns+" FROM personal_tokens WHERE token_hash = ?", storage.HashToken(token),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get personal token: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *PersonalTokenStorage) GetByUserId(id, userId uint64) (*types.PersonalToken, error) {
+	t, err := scanPersonalToken(s.queryRow(
+		"SELECT "+personalTokenColumns+" FROM personal_tokens WHERE id = ? AND user_id = ?", id, userId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get personal token: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *PersonalTokenStorage) GetAllByUser(userId uint64) ([]types.PersonalToken, error) {
+	rows, err := s.query(
+		"SELECT "+personalTokenColumns+" FROM personal_tokens WHERE user_id = ? ORDER BY created DESC, id DESC", userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	tokens := make([]types.PersonalToken, 0)
+	for rows.Next() {
+		t, err := scanPersonalToken(rows)
+		if err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		tokens = append(tokens, *t)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return tokens, nil
+}
+
+func (s *PersonalTokenStorage) Touch(id uint64, lastUsed time.Time) error {
+	_, err := s.exec("UPDATE personal_tokens SET last_used = ? WHERE id = ?", lastUsed, id)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *PersonalTokenStorage) Delete(id, userId uint64) error {
+	_, err := s.exec("DELETE FROM personal_tokens WHERE id = ? AND user_id = ?", id, userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *PersonalTokenStorage) DeleteByUser(userId uint64) (int64, error) {
+	res, err := s.exec("DELETE FROM personal_tokens WHERE user_id = ?", userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *PersonalTokenStorage) CleanupExpiredTokens() {
+	_, err := s.exec("DELETE FROM personal_tokens WHERE expire < ?", time.Now().UTC())
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
+
+func scanPersonalToken(row scanner) (*types.PersonalToken, error) {
+	var t types.PersonalToken
+	var scopes string
+	var lastUsed, expire sql.NullTime
+	err := row.Scan(&t.ID, &t.TokenHash, &t.Name, &scopes, &t.Created, &lastUsed, &expire, &t.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	t.Scopes = strings.Fields(scopes)
+	if lastUsed.Valid {
+		t.LastUsed = &lastUsed.Time
+	}
+	if expire.Valid {
+		t.Expire = &expire.Time
+	}
+
+	return &t, nil
+}
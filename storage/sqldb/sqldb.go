@@ -0,0 +1,164 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+const (
+	MySQL    = "mysql"
+	SQLite   = "sqlite"
+	Postgres = "postgres"
+)
+
+type Config struct {
+	Driver   string
+	Host     string
+	Database string
+	User     string
+	Password string
+	SSLMode  string
+}
+
+type Storage struct {
+	DB     *sql.DB
+	Driver string
+}
+
+// NewStorage opens a database for the configured driver. For SQLite the
+// database is the path to the database file and the other fields are ignored.
+func NewStorage(c Config) (*Storage, error) {
+	var driverName, dsn string
+	switch c.Driver {
+	case MySQL, "":
+		c.Driver = MySQL
+		driverName = "mysql"
+		dsn = c.User + ":" + c.Password + "@(" + c.Host + ")/" + c.Database + "?parseTime=true"
+	case SQLite:
+		driverName = "sqlite3"
+		dsn = "file:" + c.Database + "?_foreign_keys=on&_busy_timeout=5000&_journal_mode=WAL"
+	case Postgres:
+		driverName = "postgres"
+		sslMode := c.SSLMode
+		if sslMode == "" {
+			sslMode = "disable"
+		}
+		u := url.URL{
+			Scheme:   "postgres",
+			User:     url.UserPassword(c.User, c.Password),
+			Host:     c.Host,
+			Path:     "/" + c.Database,
+			RawQuery: "sslmode=" + url.QueryEscape(sslMode),
+		}
+		dsn = u.String()
+	default:
+		return nil, fmt.Errorf("unsupported db driver %q", c.Driver)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Ping()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Storage{DB: db, Driver: c.Driver}
+
+	return s, nil
+}
+
+// rebind rewrites the ? placeholders used by the queries in this package
+// into the $1, $2, ... form expected by PostgreSQL.
+func (s *Storage) rebind(query string) string {
+	if s.Driver != Postgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// isDuplicate reports whether err is a unique constraint violation, so the
+// stores can return storage.ErrDuplicate for every driver.
+func isDuplicate(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+
+	return false
+}
+
+func (s *Storage) exec(query string, args ...interface{}) (sql.Result, error) {
+	return s.DB.Exec(s.rebind(query), args...)
+}
+
+func (s *Storage) query(query string, args ...interface{}) (*sql.Rows, error) {
+	return s.DB.Query(s.rebind(query), args...)
+}
+
+func (s *Storage) queryRow(query string, args ...interface{}) *sql.Row {
+	return s.DB.QueryRow(s.rebind(query), args...)
+}
+
+// inTx runs fn in a transaction that is committed when fn returns nil.
+func (s *Storage) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+var (
+	_ storage.TodoStore          = (*TodoStorage)(nil)
+	_ storage.TokenStore         = (*TokenStorage)(nil)
+	_ storage.PersonalTokenStore = (*PersonalTokenStorage)(nil)
+	_ storage.TwoFactorStore     = (*TwoFactorStorage)(nil)
+	_ storage.AttemptStore       = (*AttemptStorage)(nil)
+	_ storage.PasswordResetStore = (*PasswordResetStorage)(nil)
+	_ storage.EmailChangeStore   = (*EmailChangeStorage)(nil)
+	_ storage.ImpersonationStore = (*ImpersonationStorage)(nil)
+	_ storage.AuthEventStore     = (*AuthEventStorage)(nil)
+	_ storage.UserStore          = (*UserStorage)(nil)
+)
@@ -0,0 +1,180 @@
+package sqldb
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/iwajezhgf/todo-backend/schemas"
+	"github.com/iwajezhgf/todo-backend/storage/storetest"
+)
+
+// TestStores runs the store suite on SQLite, and on MySQL and PostgreSQL when
+// TODO_TEST_MYSQL or TODO_TEST_POSTGRES hold "user:password@host:port/database".
+// Those databases are migrated down and up again for every test, so they
+// must not hold anything worth keeping.
+func TestStores(t *testing.T) {
+	t.Run(SQLite, func(t *testing.T) {
+		storetest.Run(t, func(t *testing.T) storetest.Stores {
+			return openStores(t, Config{Driver: SQLite, Database: filepath.Join(t.TempDir(), "test.db")})
+		})
+	})
+
+	for _, d := range serverDrivers {
+		t.Run(d.driver, func(t *testing.T) {
+			c := serverConfig(t, d.driver, d.env)
+			storetest.Run(t, func(t *testing.T) storetest.Stores {
+				return openStores(t, c)
+			})
+		})
+	}
+}
+
+// serverDrivers are the drivers of database servers and the environment
+// variables that point the tests at one.
+var serverDrivers = []struct{ driver, env string }{{MySQL, "TODO_TEST_MYSQL"}, {Postgres, "TODO_TEST_POSTGRES"}}
+
+// serverConfig returns the config for the database in env, or skips the test
+// when env is not set.
+func serverConfig(t *testing.T, driver, env string) Config {
+	t.Helper()
+
+	dsn := os.Getenv(env)
+	if dsn == "" {
+		t.Skip(env + " is not set")
+	}
+	u, err := url.Parse("db://" + dsn)
+	if err != nil {
+		t.Fatalf("%s: %v", env, err)
+	}
+	password, _ := u.User.Password()
+
+	return Config{
+		Driver:   driver,
+		Host:     u.Host,
+		Database: u.Path[1:],
+		User:     u.User.Username(),
+		Password: password,
+		SSLMode:  u.Query().Get("sslmode"),
+	}
+}
+
+// openStores opens the database of c with every migration freshly applied.
+func openStores(t *testing.T, c Config) storetest.Stores {
+	t.Helper()
+
+	db, err := NewStorage(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.DB.Close() })
+
+	migrations, err := LoadMigrations(schemas.FS, c.Driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.MigrateDown(migrations, len(migrations)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = db.MigrateUp(migrations); err != nil {
+		t.Fatal(err)
+	}
+
+	return storetest.Stores{
+		Todos:          &TodoStorage{Storage: db},
+		Tokens:         &TokenStorage{Storage: db},
+		PersonalTokens: &PersonalTokenStorage{Storage: db},
+		TwoFactor:      &TwoFactorStorage{Storage: db},
+		Attempts:       &AttemptStorage{Storage: db},
+		PasswordResets: &PasswordResetStorage{Storage: db},
+		EmailChanges:   &EmailChangeStorage{Storage: db},
+		Impersonations: &ImpersonationStorage{Storage: db},
+		AuthEvents:     &AuthEventStorage{Storage: db},
+		Users:          &UserStorage{Storage: db},
+	}
+}
+
+// TestBaseline marks the init migration of tables created by hand as applied,
+// so that the later migrations can run on them.
+func TestBaseline(t *testing.T) {
+	db, err := NewStorage(Config{Driver: SQLite, Database: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.DB.Close()
+
+	migrations, err := LoadMigrations(schemas.FS, SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stmt := range splitStatements(migrations[0].Up) {
+		if _, err = db.DB.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err = db.Baseline(migrations, "19700101000000"); err == nil {
+		t.Error("Baseline of an unknown version succeeded")
+	}
+	recorded, err := db.Baseline(migrations, migrations[0].Version)
+	if err != nil || len(recorded) != 1 || recorded[0].Version != migrations[0].Version {
+		t.Fatalf("Baseline = %+v, %v, want the init migration", recorded, err)
+	}
+	if recorded, err = db.Baseline(migrations, migrations[0].Version); err != nil || len(recorded) != 0 {
+		t.Errorf("second Baseline = %+v, %v, want nothing", recorded, err)
+	}
+
+	applied, err := db.MigrateUp(migrations)
+	if err != nil || len(applied) != len(migrations)-1 {
+		t.Fatalf("MigrateUp after Baseline = %d migrations, %v, want %d", len(applied), err, len(migrations)-1)
+	}
+}
+
+// TestConcurrentMigrateUp starts two servers with auto_migrate at once: the
+// migration lock must keep them from applying the same migration twice.
+func TestConcurrentMigrateUp(t *testing.T) {
+	for _, d := range serverDrivers {
+		t.Run(d.driver, func(t *testing.T) {
+			c := serverConfig(t, d.driver, d.env)
+			migrations, err := LoadMigrations(schemas.FS, d.driver)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			dbs := make([]*Storage, 2)
+			for i := range dbs {
+				if dbs[i], err = NewStorage(c); err != nil {
+					t.Fatal(err)
+				}
+				defer dbs[i].DB.Close()
+			}
+			if _, err = dbs[0].MigrateDown(migrations, len(migrations)); err != nil {
+				t.Fatal(err)
+			}
+
+			applied := make([]int, len(dbs))
+			errs := make([]error, len(dbs))
+			var wg sync.WaitGroup
+			for i, db := range dbs {
+				wg.Add(1)
+				go func(i int, db *Storage) {
+					defer wg.Done()
+					done, err := db.MigrateUp(migrations)
+					applied[i], errs[i] = len(done), err
+				}(i, db)
+			}
+			wg.Wait()
+
+			for i, err := range errs {
+				if err != nil {
+					t.Errorf("MigrateUp %d: %v", i, err)
+				}
+			}
+			if applied[0]+applied[1] != len(migrations) {
+				t.Errorf("MigrateUp applied %d and %d migrations, want %d in total", applied[0], applied[1], len(migrations))
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type TodoStorage struct {
+	*Storage
+}
+
+func (s *TodoStorage) Create(title, note string, expire time.Time, userId uint64) error {
+	_, err := s.exec(
+		"INSERT INTO todos (title, note, created, expire, user_id) VALUES (?, ?, ?, ?, ?)", title, note,
+		time.Now().UTC(), expire.UTC(), userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TodoStorage) GetByUserId(id, userId uint64) (*types.Todo, error) {
+	var t types.Todo
+	err := s.queryRow(
+		"SELECT id, title, note, created, expire, status, user_id FROM todos WHERE user_id = ? AND id = ?", userId, id,
+	).Scan(&t.ID, &t.Title, &t.Note, &t.Created, &t.Expire, &t.Status, &t.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get todo: %w", err)
+	}
+	t.Created, t.Expire = t.Created.UTC(), t.Expire.UTC()
+
+	return &t, nil
+}
+
+func (s *TodoStorage) GetTodosByPage(userId uint64, page, limit int) (*types.TodoData, error) {
+	queryCount := "SELECT COUNT(*) FROM todos WHERE user_id = ?"
+	var totalRecords int
+	err := s.queryRow(queryCount, userId).Scan(&totalRecords)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	offset := (page - 1) * limit
+	query := "SELECT * FROM todos WHERE user_id = ? ORDER BY created DESC, id DESC LIMIT ? OFFSET ?"
+
+	rows, err := s.query(query, userId, limit, offset)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	todos := make([]types.Todo, 0)
+	for rows.Next() {
+		var todo types.Todo
+		err = rows.Scan(&todo.ID, &todo.Title, &todo.Note, &todo.Created, &todo.Expire, &todo.Status, &todo.UserID)
+		if err != nil {
+			log.Println("db error: ", err)
+			continue
+		}
+		todo.Created, todo.Expire = todo.Created.UTC(), todo.Expire.UTC()
+		todos = append(todos, todo)
+	}
+
+	data := types.TodoData{
+		Items:      todos,
+		Pagination: storage.NewPagination(page, limit, totalRecords),
+	}
+
+	return &data, nil
+}
+
+func (s *TodoStorage) GetAllByUser(userId uint64) ([]types.Todo, error) {
+	rows, err := s.query("SELECT * FROM todos WHERE user_id = ? ORDER BY created DESC, id DESC", userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	todos := make([]types.Todo, 0)
+	for rows.Next() {
+		var todo types.Todo
+		err = rows.Scan(&todo.ID, &todo.Title, &todo.Note, &todo.Created, &todo.Expire, &todo.Status, &todo.UserID)
+		if err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		todo.Created, todo.Expire = todo.Created.UTC(), todo.Expire.UTC()
+		todos = append(todos, todo)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return todos, nil
+}
+
+func (s *TodoStorage) Edit(title, note string, expire time.Time, id, userId uint64) error {
+	_, err := s.exec(
+		"UPDATE todos SET title = ?, note = ?, expire = ? WHERE id = ? AND user_id = ?",
+		title,
+		note,
+		expire.UTC(),
+		id,
+		userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TodoStorage) EditStatus(id, userId uint64, status string) error {
+	_, err := s.exec(
+		"UPDATE todos SET status = ? WHERE id = ? AND user_id = ?",
+		status,
+		id,
+		userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TodoStorage) Delete(id uint64) {
+	_, err := s.exec("DELETE FROM todos WHERE id = ?", id)
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
+
+func (s *TodoStorage) CheckTodoStatus() {
+	rows, err := s.query("SELECT id, expire FROM todos WHERE status != 'completed'")
+	if err != nil {
+		log.Println("db error: ", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id uint64
+		var expire time.Time
+		if err = rows.Scan(&id, &expire); err != nil {
+			log.Println("db error: ", err)
+			continue
+		}
+
+		if time.Now().UTC().After(expire) {
+			if _, err = s.exec("UPDATE todos SET status = 'overdue' WHERE id = ?", id); err != nil {
+				log.Println("db error: ", err)
+				continue
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+	}
+}
+
+// RecomputeStatus sets every todo that is not completed to overdue or active
+// based on its current expire time and returns the number of changed todos.
+func (s *TodoStorage) RecomputeStatus() (int64, error) {
+	now := time.Now().UTC()
+
+	var changed int64
+	for _, query := range []string{
+		"UPDATE todos SET status = 'overdue' WHERE status = 'active' AND expire < ?",
+		"UPDATE todos SET status = 'active' WHERE status = 'overdue' AND expire >= ?",
+	} {
+		res, err := s.exec(query, now)
+		if err != nil {
+			log.Println("db error: ", err)
+			return changed, errors.New("db error")
+		}
+		n, _ := res.RowsAffected()
+		changed += n
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,321 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+const tokenColumns = "id, token_hash, name, user_agent, ip, created, last_used, expire, session_expire, user_id"
+
+type TokenStorage struct {
+	*Storage
+}
+
+func (s *TokenStorage) Create(token string, userId uint64, expire time.Time, userAgent, ip string) error {
+	now := time.Now().UTC()
+	_, err := s.exec(
+		"INSERT INTO tokens (token_hash, user_agent, ip, created, last_used, expire, user_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		storage.HashToken(token), userAgent, ip,
+		now, now, expire, userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+// CreateWithRefresh creates a session whose short-lived access token is renewed
+// with refreshToken until sessionExpire.
+func (s *TokenStorage) CreateWithRefresh(
+	token, refreshToken string, userId uint64, expire, sessionExpire time.Time, userAgent, ip string,
+) error {
+	now := time.Now().UTC()
+	tokenHash := storage.HashToken(token)
+	err := s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(
+			s.rebind("INSERT INTO tokens (token_hash, user_agent, ip, created, last_used, expire, session_expire, user_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?)"),
+			tokenHash, userAgent, ip, now, now, expire, sessionExpire, userId,
+		)
+		if err != nil {
+			return err
+		}
+
+		var sessionId uint64
+		err = tx.QueryRow(s.rebind("SELECT id FROM tokens WHERE token_hash = ?"), tokenHash).Scan(&sessionId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			s.rebind("INSERT INTO refresh_tokens (token_hash, session_id, user_id, created, used) VALUES (?, ?, ?, ?, FALSE)"),
+			storage.HashToken(refreshToken), sessionId, userId, now,
+		)
+		return err
+	})
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) GetByToken(token string) (*types.Token, error) {
+	t, err := scanToken(s.queryRow(
+		"SELECT "+tokenColumns+" FROM tokens WHERE token_hash = ?", storage.HashToken(token),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *TokenStorage) GetByUserId(id, userId uint64) (*types.Token, error) {
+	t, err := scanToken(s.queryRow(
+		"SELECT "+tokenColumns+" FROM tokens WHERE id = ? AND user_id = ?", id, userId,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	return t, nil
+}
+
+// GetAllByUser returns the user's tokens, most recently used first.
+func (s *TokenStorage) GetAllByUser(userId uint64) ([]types.Token, error) {
+	rows, err := s.query("SELECT "+tokenColumns+" FROM tokens WHERE user_id = ? ORDER BY last_used DESC, id DESC", userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	tokens := make([]types.Token, 0)
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		tokens = append(tokens, *t)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return tokens, nil
+}
+
+func (s *TokenStorage) GetRefresh(refreshToken string) (*types.RefreshToken, error) {
+	var rt types.RefreshToken
+	err := s.queryRow(
+		"SELECT id, token_hash, session_id, user_id, created, used FROM refresh_tokens WHERE token_hash = ?",
+		storage.HashToken(refreshToken),
+	).Scan(&rt.ID, &rt.TokenHash, &rt.SessionID, &rt.UserID, &rt.Created, &rt.Used)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return &rt, nil
+}
+
+// Rotate marks the refresh token used and gives its session a new access and
+// refresh token. It returns false without changing anything when the refresh
+// token was already used, which means it has been replayed.
+func (s *TokenStorage) Rotate(
+	refreshId, sessionId uint64, token, refreshToken string, expire, sessionExpire time.Time,
+) (bool, error) {
+	rotated := false
+	err := s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(s.rebind("UPDATE refresh_tokens SET used = TRUE WHERE id = ? AND used = FALSE"), refreshId)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return err
+		}
+
+		now := time.Now().UTC()
+		_, err = tx.Exec(
+			s.rebind("UPDATE tokens SET token_hash = ?, last_used = ?, expire = ?, session_expire = ? WHERE id = ?"),
+			storage.HashToken(token), now, expire, sessionExpire, sessionId,
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			s.rebind("INSERT INTO refresh_tokens (token_hash, session_id, user_id, created, used) SELECT ?, id, user_id, ?, FALSE FROM tokens WHERE id = ?"),
+			storage.HashToken(refreshToken), now, sessionId,
+		)
+		if err != nil {
+			return err
+		}
+
+		rotated = true
+		return nil
+	})
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	return rotated, nil
+}
+
+// Touch records that the token was used at lastUsed and moves its expiry.
+func (s *TokenStorage) Touch(id uint64, lastUsed, expire time.Time) error {
+	_, err := s.exec("UPDATE tokens SET last_used = ?, expire = ? WHERE id = ?", lastUsed, expire, id)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) EditName(id, userId uint64, name string) error {
+	_, err := s.exec("UPDATE tokens SET name = ? WHERE id = ? AND user_id = ?", name, id, userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) Delete(token string) {
+	_, err := s.exec("DELETE FROM tokens WHERE token_hash = ?", storage.HashToken(token))
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
+
+func (s *TokenStorage) DeleteById(id, userId uint64) error {
+	_, err := s.exec("DELETE FROM tokens WHERE id = ? AND user_id = ?", id, userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) DeleteByUser(userId uint64) (int64, error) {
+	res, err := s.exec("DELETE FROM tokens WHERE user_id = ?", userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteOthers removes every token of the user except keepId.
+func (s *TokenStorage) DeleteOthers(userId, keepId uint64) (int64, error) {
+	res, err := s.exec("DELETE FROM tokens WHERE user_id = ? AND id != ?", userId, keepId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	return res.RowsAffected()
+}
+
+func (s *TokenStorage) Deny(tokenHash string, expire time.Time) error {
+	err := s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind("DELETE FROM token_denylist WHERE token_hash = ?"), tokenHash)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind("INSERT INTO token_denylist (token_hash, expire) VALUES (?, ?)"), tokenHash, expire)
+		return err
+	})
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TokenStorage) GetDenied() (map[string]time.Time, error) {
+	rows, err := s.query("SELECT token_hash, expire FROM token_denylist WHERE expire >= ?", time.Now().UTC())
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	denied := make(map[string]time.Time)
+	for rows.Next() {
+		var hash string
+		var expire time.Time
+		if err = rows.Scan(&hash, &expire); err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		denied[hash] = expire
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return denied, nil
+}
+
+func (s *TokenStorage) CleanupExpiredTokens() {
+	now := time.Now().UTC()
+	_, err := s.exec(
+		"DELETE FROM tokens WHERE expire < ? AND (session_expire IS NULL OR session_expire < ?)", now, now,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+
+	_, err = s.exec("DELETE FROM token_denylist WHERE expire < ?", now)
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanToken(row scanner) (*types.Token, error) {
+	var t types.Token
+	var sessionExpire sql.NullTime
+	err := row.Scan(
+		&t.ID, &t.TokenHash, &t.Name, &t.UserAgent, &t.IP, &t.Created, &t.LastUsed, &t.Expire, &sessionExpire, &t.UserID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if sessionExpire.Valid {
+		t.SessionExpire = &sessionExpire.Time
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,233 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+type TwoFactorStorage struct {
+	*Storage
+}
+
+func (s *TwoFactorStorage) SetSecret(userId uint64, secret string) error {
+	err := s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind("DELETE FROM two_factor WHERE user_id = ? AND enabled = FALSE"), userId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			s.rebind("INSERT INTO two_factor (user_id, secret, enabled, last_step, created) VALUES (?, ?, FALSE, 0, ?)"),
+			userId, secret, time.Now().UTC(),
+		)
+		return err
+	})
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) Get(userId uint64) (*types.TwoFactor, error) {
+	var tf types.TwoFactor
+	err := s.queryRow(
+		"SELECT user_id, secret, enabled, last_step, created FROM two_factor WHERE user_id = ?", userId,
+	).Scan(&tf.UserID, &tf.Secret, &tf.Enabled, &tf.LastStep, &tf.Created)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get two-factor secret: %w", err)
+	}
+
+	return &tf, nil
+}
+
+func (s *TwoFactorStorage) Enable(userId uint64, step int64, recoveryCodes []string) error {
+	err := s.inTx(func(tx *sql.Tx) error {
+		res, err := tx.Exec(
+			s.rebind("UPDATE two_factor SET enabled = TRUE, last_step = ? WHERE user_id = ? AND enabled = FALSE"),
+			step, userId,
+		)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return storage.ErrNotFound
+		}
+
+		return s.replaceRecoveryCodes(tx, userId, recoveryCodes)
+	})
+	if errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) replaceRecoveryCodes(tx *sql.Tx, userId uint64, codes []string) error {
+	_, err := tx.Exec(s.rebind("DELETE FROM recovery_codes WHERE user_id = ?"), userId)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		_, err = tx.Exec(
+			s.rebind("INSERT INTO recovery_codes (code_hash, user_id, used) VALUES (?, ?, FALSE)"),
+			storage.HashToken(code), userId,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) UseStep(userId uint64, step int64) (bool, error) {
+	res, err := s.exec(
+		"UPDATE two_factor SET last_step = ? WHERE user_id = ? AND last_step < ?", step, userId, step,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	return n > 0, nil
+}
+
+func (s *TwoFactorStorage) UseRecoveryCode(userId uint64, code string) (bool, error) {
+	res, err := s.exec(
+		"UPDATE recovery_codes SET used = TRUE WHERE user_id = ? AND code_hash = ? AND used = FALSE",
+		userId, storage.HashToken(code),
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	return n > 0, nil
+}
+
+func (s *TwoFactorStorage) CountRecoveryCodes(userId uint64) (int, error) {
+	var count int
+	err := s.queryRow("SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used = FALSE", userId).Scan(&count)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	return count, nil
+}
+
+// Disable removes the secret, the recovery codes and pending login challenges.
+func (s *TwoFactorStorage) Disable(userId uint64) error {
+	err := s.inTx(func(tx *sql.Tx) error {
+		for _, query := range []string{
+			"DELETE FROM login_challenges WHERE user_id = ?",
+			"DELETE FROM recovery_codes WHERE user_id = ?",
+			"DELETE FROM two_factor WHERE user_id = ?",
+		} {
+			if _, err := tx.Exec(s.rebind(query), userId); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) CreateChallenge(token string, userId uint64, expire time.Time) error {
+	_, err := s.exec(
+		"INSERT INTO login_challenges (token_hash, user_id, attempts, expire) VALUES (?, ?, 0, ?)",
+		storage.HashToken(token), userId, expire,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) GetChallenge(token string) (*types.LoginChallenge, error) {
+	var c types.LoginChallenge
+	err := s.queryRow(
+		"SELECT id, token_hash, user_id, attempts, expire FROM login_challenges WHERE token_hash = ?",
+		storage.HashToken(token),
+	).Scan(&c.ID, &c.TokenHash, &c.UserID, &c.Attempts, &c.Expire)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+
+	return &c, nil
+}
+
+func (s *TwoFactorStorage) FailChallenge(id uint64) error {
+	_, err := s.exec("UPDATE login_challenges SET attempts = attempts + 1 WHERE id = ?", id)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *TwoFactorStorage) DeleteChallenge(id uint64) (bool, error) {
+	res, err := s.exec("DELETE FROM login_challenges WHERE id = ?", id)
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		log.Println("db error: ", err)
+		return false, errors.New("db error")
+	}
+
+	return n > 0, nil
+}
+
+func (s *TwoFactorStorage) CleanupExpiredTokens() {
+	_, err := s.exec("DELETE FROM login_challenges WHERE expire < ?", time.Now().UTC())
+	if err != nil {
+		log.Println("db error: ", err)
+	}
+}
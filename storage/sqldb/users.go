@@ -0,0 +1,320 @@
+package sqldb
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+const userColumns = "id, email, password, verified_at, delete_after, role, disabled_at, " +
+	"display_name, time_zone, locale, week_start, avatar_url"
+
+type UserStorage struct {
+	*Storage
+}
+
+func (s *UserStorage) Create(email string, password []byte) error {
+	_, err := s.exec("INSERT INTO users (email, password) VALUES (?, ?)", email, password)
+	if isDuplicate(err) {
+		return storage.ErrDuplicate
+	}
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *UserStorage) GetById(id uint64) (*types.User, error) {
+	user, err := scanUser(s.queryRow("SELECT "+userColumns+" FROM users WHERE id = ?", id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *UserStorage) GetByEmail(email string) (*types.User, error) {
+	user, err := scanUser(s.queryRow("SELECT "+userColumns+" FROM users WHERE email = ?", email))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *UserStorage) EditPassword(userId uint64, password []byte) error {
+	_, err := s.exec(
+		"UPDATE users SET password = ? WHERE id = ?",
+		password,
+		userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *UserStorage) EditProfile(userId uint64, p types.Profile) error {
+	_, err := s.exec(
+		"UPDATE users SET display_name = ?, time_zone = ?, locale = ?, week_start = ?, avatar_url = ? WHERE id = ?",
+		p.DisplayName, p.TimeZone, p.Locale, p.WeekStart, p.AvatarURL, userId,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *UserStorage) SetRole(userId uint64, role string) error {
+	_, err := s.exec("UPDATE users SET role = ? WHERE id = ?", role, userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *UserStorage) SetDisabled(userId uint64, at *time.Time) error {
+	_, err := s.exec("UPDATE users SET disabled_at = ? WHERE id = ?", at, userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern for ESCAPE '!', which
+// unlike a backslash means the same to every driver.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+func (s *UserStorage) Search(query string, page, limit int) (*types.UserData, error) {
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(query)) + "%"
+	const where = " FROM users WHERE LOWER(email) LIKE ? ESCAPE '!' OR LOWER(display_name) LIKE ? ESCAPE '!'"
+
+	var totalRecords int
+	err := s.queryRow("SELECT COUNT(*)"+where, pattern, pattern).Scan(&totalRecords)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	rows, err := s.query(
+		"SELECT "+userColumns+where+" ORDER BY id LIMIT ? OFFSET ?", pattern, pattern, limit, (page-1)*limit,
+	)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+	defer rows.Close()
+
+	users := make([]types.User, 0)
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			log.Println("db error: ", err)
+			return nil, errors.New("db error")
+		}
+		users = append(users, *u)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return &types.UserData{
+		Items:      users,
+		Pagination: storage.NewPagination(page, limit, totalRecords),
+	}, nil
+}
+
+func (s *UserStorage) Usage(userId uint64) (*types.Usage, error) {
+	var u types.Usage
+	err := s.queryRow(
+		"SELECT (SELECT COUNT(*) FROM todos WHERE user_id = ?), "+
+			"(SELECT COUNT(*) FROM tokens WHERE user_id = ?), "+
+			"(SELECT COUNT(*) FROM personal_tokens WHERE user_id = ?)",
+		userId, userId, userId,
+	).Scan(&u.Todos, &u.Sessions, &u.PersonalTokens)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return &u, nil
+}
+
+func (s *UserStorage) TotalUsage() (*types.TotalUsage, error) {
+	var u types.TotalUsage
+	err := s.queryRow(
+		"SELECT (SELECT COUNT(*) FROM users), "+
+			"(SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL), "+
+			"(SELECT COUNT(*) FROM todos), "+
+			"(SELECT COUNT(*) FROM tokens), "+
+			"(SELECT COUNT(*) FROM personal_tokens)",
+	).Scan(&u.Users, &u.DisabledUsers, &u.Todos, &u.Sessions, &u.PersonalTokens)
+	if err != nil {
+		log.Println("db error: ", err)
+		return nil, errors.New("db error")
+	}
+
+	return &u, nil
+}
+
+func (s *UserStorage) CountEnabled(role string) (int, error) {
+	var n int
+	err := s.queryRow("SELECT COUNT(*) FROM users WHERE role = ? AND disabled_at IS NULL", role).Scan(&n)
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	return n, nil
+}
+
+func (s *UserStorage) Verify(userId uint64, at time.Time) error {
+	_, err := s.exec("UPDATE users SET verified_at = ? WHERE id = ? AND verified_at IS NULL", at, userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *UserStorage) EditEmail(userId uint64, email string) error {
+	_, err := s.exec(
+		"UPDATE users SET email = ?, verified_at = ? WHERE id = ?", email, time.Now().UTC(), userId,
+	)
+	if isDuplicate(err) {
+		return storage.ErrDuplicate
+	}
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *UserStorage) ScheduleDeletion(userId uint64, at *time.Time) error {
+	_, err := s.exec("UPDATE users SET delete_after = ? WHERE id = ?", at, userId)
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func (s *UserStorage) PurgeDeleted() (int64, error) {
+	rows, err := s.query("SELECT id FROM users WHERE delete_after < ?", time.Now().UTC())
+	if err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	var ids []uint64
+	for rows.Next() {
+		var id uint64
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Println("db error: ", err)
+			return 0, errors.New("db error")
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		log.Println("db error: ", err)
+		return 0, errors.New("db error")
+	}
+
+	var deleted int64
+	for _, id := range ids {
+		if err = s.Delete(id); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// Delete removes the user together with all of their todos and tokens. The
+// security log and the impersonation audit are kept, but no longer point to
+// the user: user ids become NULL, or 0 where the column cannot be NULL, and
+// emails, IP addresses, user agents and reasons are cleared.
+func (s *UserStorage) Delete(id uint64) error {
+	err := s.inTx(func(tx *sql.Tx) error {
+		for _, query := range []string{
+			"UPDATE auth_events SET user_id = NULL, email = '', ip = '', user_agent = '' WHERE user_id = ?",
+			"UPDATE impersonation_audit SET user_id = 0 WHERE user_id = ?",
+			"UPDATE impersonation_audit SET admin_id = 0 WHERE admin_id = ?",
+			"UPDATE impersonations SET user_id = 0, reason = '' WHERE user_id = ?",
+			"UPDATE impersonations SET admin_id = 0 WHERE admin_id = ?",
+			"DELETE FROM todos WHERE user_id = ?",
+			"DELETE FROM tokens WHERE user_id = ?",
+			"DELETE FROM personal_tokens WHERE user_id = ?",
+			"DELETE FROM login_challenges WHERE user_id = ?",
+			"DELETE FROM recovery_codes WHERE user_id = ?",
+			"DELETE FROM two_factor WHERE user_id = ?",
+			"DELETE FROM password_resets WHERE user_id = ?",
+			"DELETE FROM email_changes WHERE user_id = ?",
+			"DELETE FROM users WHERE id = ?",
+		} {
+			if _, err := tx.Exec(s.rebind(query), id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Println("db error: ", err)
+		return errors.New("db error")
+	}
+
+	return nil
+}
+
+func scanUser(row scanner) (*types.User, error) {
+	var user types.User
+	var verifiedAt, deleteAfter, disabledAt sql.NullTime
+	err := row.Scan(
+		&user.ID, &user.Email, &user.Password, &verifiedAt, &deleteAfter, &user.Role, &disabledAt,
+		&user.DisplayName, &user.TimeZone, &user.Locale, &user.WeekStart, &user.AvatarURL,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		user.VerifiedAt = &verifiedAt.Time
+	}
+	if deleteAfter.Valid {
+		user.DeleteAfter = &deleteAfter.Time
+	}
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
+	}
+
+	return &user, nil
+}
@@ -1,27 +1,269 @@
 package storage
 
 import (
-	"database/sql"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/iwajezhgf/todo-backend/types"
 )
 
-type Storage struct {
-	DB *sql.DB
+// ErrNotFound is returned by the stores when the requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when a write would break a unique constraint, such
+// as two users with the same email.
+var ErrDuplicate = errors.New("already exists")
+
+// HashToken returns the SHA-256 digest of a bearer token. Only the digest is
+// persisted, so a leaked database does not contain usable tokens.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+type TodoStore interface {
+	Create(title, note string, expire time.Time, userId uint64) error
+	GetByUserId(id, userId uint64) (*types.Todo, error)
+	GetTodosByPage(userId uint64, page, limit int) (*types.TodoData, error)
+	GetAllByUser(userId uint64) ([]types.Todo, error)
+	Edit(title, note string, expire time.Time, id, userId uint64) error
+	EditStatus(id, userId uint64, status string) error
+	Delete(id uint64)
+	CheckTodoStatus()
+	RecomputeStatus() (int64, error)
+}
+
+type TokenStore interface {
+	Create(token string, userId uint64, expire time.Time, userAgent, ip string) error
+	CreateWithRefresh(token, refreshToken string, userId uint64, expire, sessionExpire time.Time, userAgent, ip string) error
+	GetByToken(token string) (*types.Token, error)
+	GetByUserId(id, userId uint64) (*types.Token, error)
+	GetRefresh(refreshToken string) (*types.RefreshToken, error)
+	Rotate(refreshId, sessionId uint64, token, refreshToken string, expire, sessionExpire time.Time) (bool, error)
+	GetAllByUser(userId uint64) ([]types.Token, error)
+	Touch(id uint64, lastUsed, expire time.Time) error
+	EditName(id, userId uint64, name string) error
+	Delete(token string)
+	DeleteById(id, userId uint64) error
+	DeleteByUser(userId uint64) (int64, error)
+	DeleteOthers(userId, keepId uint64) (int64, error)
+	// Deny records the digest of a revoked stateless token until it expires.
+	Deny(tokenHash string, expire time.Time) error
+	GetDenied() (map[string]time.Time, error)
+	CleanupExpiredTokens()
+}
+
+type PersonalTokenStore interface {
+	Create(token, name string, scopes []string, expire *time.Time, userId uint64) error
+	GetByToken(token string) (*types.PersonalToken, error)
+	GetByUserId(id, userId uint64) (*types.PersonalToken, error)
+	GetAllByUser(userId uint64) ([]types.PersonalToken, error)
+	Touch(id uint64, lastUsed time.Time) error
+	Delete(id, userId uint64) error
+	DeleteByUser(userId uint64) (int64, error)
+	CleanupExpiredTokens()
+}
+
+type ImpersonationStore interface {
+	Create(token string, adminId, userId uint64, reason string, expire time.Time) error
+	GetByToken(token string) (*types.Impersonation, error)
+	GetById(id uint64) (*types.Impersonation, error)
+	// GetActiveByUser returns the impersonations that have neither ended nor
+	// expired and were started by or act as the user.
+	GetActiveByUser(userId uint64, now time.Time) ([]types.Impersonation, error)
+	// End marks the impersonation as ended. It returns false when it
+	// already was.
+	End(id uint64, at time.Time) (bool, error)
+	Record(entry types.ImpersonationAudit) error
+	GetAudit(impersonationId uint64) ([]types.ImpersonationAudit, error)
+}
+
+// AuthEventStore holds the security log. Events are never changed, only
+// deleted once they are older than the retention period.
+type AuthEventStore interface {
+	Record(e types.AuthEvent) error
+	// Search returns a page of the events matching f, newest first.
+	Search(f types.AuthEventFilter, page, limit int) (*types.AuthEventData, error)
+	// DeleteBefore deletes the events created before t.
+	DeleteBefore(t time.Time) (int64, error)
+}
+
+type TwoFactorStore interface {
+	// SetSecret stores an unconfirmed TOTP secret, replacing an earlier
+	// unconfirmed one.
+	SetSecret(userId uint64, secret string) error
+	Get(userId uint64) (*types.TwoFactor, error)
+	// Enable confirms the secret with the step of the first code and replaces
+	// the user's recovery codes.
+	Enable(userId uint64, step int64, recoveryCodes []string) error
+	// UseStep records step as the last accepted TOTP step. It reports false
+	// when that step or a later one was already used.
+	UseStep(userId uint64, step int64) (bool, error)
+	// UseRecoveryCode marks the code as used. It reports false when the code
+	// does not exist or was already used.
+	UseRecoveryCode(userId uint64, code string) (bool, error)
+	CountRecoveryCodes(userId uint64) (int, error)
+	Disable(userId uint64) error
+
+	CreateChallenge(token string, userId uint64, expire time.Time) error
+	GetChallenge(token string) (*types.LoginChallenge, error)
+	FailChallenge(id uint64) error
+	// DeleteChallenge reports false when the challenge was already used.
+	DeleteChallenge(id uint64) (bool, error)
+	CleanupExpiredTokens()
+}
+
+// AttemptStore keeps failed login counters in the database so that every
+// instance sees the same lockouts.
+type AttemptStore interface {
+	Get(key string) (*types.LoginAttempt, error)
+	// Fail counts a failed attempt that is remembered until expire and returns
+	// the number of failures, starting over if the earlier ones expired.
+	Fail(key string, expire time.Time) (int, error)
+	Lock(key string, until time.Time) error
+	Reset(key string) error
+	CleanupExpiredTokens()
+}
+
+type PasswordResetStore interface {
+	Create(token string, userId uint64, expire time.Time) error
+	GetByToken(token string) (*types.PasswordReset, error)
+	// Use marks the reset as used and drops the user's other resets. It
+	// reports false when the reset was already used.
+	Use(id, userId uint64) (bool, error)
+	CleanupExpiredTokens()
+}
+
+type EmailChangeStore interface {
+	Create(token, kind string, userId uint64, oldEmail, newEmail string, expire time.Time) error
+	GetByToken(token string) (*types.EmailChange, error)
+	// Use marks the token as used. It reports false when it already was.
+	Use(id uint64) (bool, error)
+	CleanupExpiredTokens()
+}
+
+// DefaultProfile is the profile of a new user, matching the column defaults
+// of the users table.
+var DefaultProfile = types.Profile{
+	TimeZone:  "UTC",
+	Locale:    "en",
+	WeekStart: "monday",
 }
 
-func NewStorage(host, database, user, password string) (*Storage, error) {
-	db, err := sql.Open("mysql", user+":"+password+"@("+host+")/"+database+"?parseTime=true")
-	if err != nil {
-		return nil, err
+type UserStore interface {
+	Create(email string, password []byte) error
+	GetById(id uint64) (*types.User, error)
+	GetByEmail(email string) (*types.User, error)
+	EditPassword(userId uint64, password []byte) error
+	EditProfile(userId uint64, p types.Profile) error
+	SetRole(userId uint64, role string) error
+	// SetDisabled disables the account at the given time; nil enables it.
+	SetDisabled(userId uint64, at *time.Time) error
+	// Search returns a page of the users whose email or display name
+	// contains query, ignoring case. An empty query matches every user.
+	Search(query string, page, limit int) (*types.UserData, error)
+	Usage(userId uint64) (*types.Usage, error)
+	TotalUsage() (*types.TotalUsage, error)
+	// CountEnabled returns the number of users with the role whose account is
+	// not disabled.
+	CountEnabled(role string) (int, error)
+	Verify(userId uint64, at time.Time) error
+	// EditEmail changes the user's email, which counts as verified from now
+	// on. It returns ErrDuplicate when another user has the email.
+	EditEmail(userId uint64, email string) error
+	// ScheduleDeletion sets when the account is deleted; nil cancels it.
+	ScheduleDeletion(userId uint64, at *time.Time) error
+	// PurgeDeleted deletes the accounts whose deletion time has passed.
+	PurgeDeleted() (int64, error)
+	Delete(id uint64) error
+}
+
+// NewPagination builds the prev/next page lists for the given page of a
+// listing with totalRecords items split into pages of limit items.
+func NewPagination(page, limit, totalRecords int) types.Pagination {
+	totalPages := (totalRecords + limit - 1) / limit
+
+	prevPages := []int{}
+	if prevPage := page - 1; prevPage > 0 {
+		prevPages = append(prevPages, prevPage)
+	}
+
+	nextPages := []int{}
+	if nextPage := page + 1; nextPage <= totalPages {
+		nextPages = append(nextPages, nextPage)
+	}
+
+	return types.Pagination{
+		Prev: prevPages,
+		Next: nextPages,
 	}
+}
+
+func StartTodoStatus(todos TodoStore) {
+	ticker := time.NewTicker(1 * time.Minute)
+	defer ticker.Stop()
 
-	err = db.Ping()
-	if err != nil {
-		return nil, err
+	for {
+		select {
+		case <-ticker.C:
+			todos.CheckTodoStatus()
+		}
 	}
+}
 
-	mysql := &Storage{DB: db}
+// StartAccountPurge deletes accounts once their grace period is over.
+func StartAccountPurge(users UserStore) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-	return mysql, nil
+	for {
+		select {
+		case <-ticker.C:
+			if n, err := users.PurgeDeleted(); err == nil && n > 0 {
+				log.Printf("deleted %d accounts after their grace period", n)
+			}
+		}
+	}
+}
+
+// StartAuthEventRetention deletes auth events once they are older than
+// retention. A retention of zero keeps them forever.
+func StartAuthEventRetention(events AuthEventStore, retention time.Duration) {
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if n, err := events.DeleteBefore(time.Now().UTC().Add(-retention)); err == nil && n > 0 {
+				log.Printf("deleted %d auth events after the retention period", n)
+			}
+		}
+	}
+}
+
+// TokenCleaner is implemented by the stores that hold expiring tokens.
+type TokenCleaner interface {
+	CleanupExpiredTokens()
+}
+
+func StartTokenCleanup(stores ...TokenCleaner) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, s := range stores {
+				s.CleanupExpiredTokens()
+			}
+		}
+	}
 }
@@ -0,0 +1,965 @@
+// Package storetest checks that a storage backend behaves the way the API
+// expects. Every backend runs the same suite, so the in-memory stores used in
+// handler tests and demo mode cannot drift from the SQL ones.
+package storetest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iwajezhgf/todo-backend/storage"
+	"github.com/iwajezhgf/todo-backend/types"
+)
+
+// Stores are the stores of one backend, sharing one empty database.
+type Stores struct {
+	Todos          storage.TodoStore
+	Tokens         storage.TokenStore
+	PersonalTokens storage.PersonalTokenStore
+	TwoFactor      storage.TwoFactorStore
+	Attempts       storage.AttemptStore
+	PasswordResets storage.PasswordResetStore
+	EmailChanges   storage.EmailChangeStore
+	Impersonations storage.ImpersonationStore
+	AuthEvents     storage.AuthEventStore
+	Users          storage.UserStore
+}
+
+// Run runs the suite. open is called once per test and must return stores
+// backed by an empty database.
+func Run(t *testing.T, open func(t *testing.T) Stores) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, s Stores)
+	}{
+		{"Users", testUsers},
+		{"UserSearch", testUserSearch},
+		{"UserDelete", testUserDelete},
+		{"Todos", testTodos},
+		{"TodoPages", testTodoPages},
+		{"TodoStatus", testTodoStatus},
+		{"Tokens", testTokens},
+		{"RefreshTokens", testRefreshTokens},
+		{"PersonalTokens", testPersonalTokens},
+		{"TwoFactor", testTwoFactor},
+		{"Attempts", testAttempts},
+		{"PasswordResets", testPasswordResets},
+		{"EmailChanges", testEmailChanges},
+		{"Impersonations", testImpersonations},
+		{"AuthEvents", testAuthEvents},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, open(t))
+		})
+	}
+}
+
+// sameTime compares times to the second, the precision of MySQL DATETIME
+// columns.
+func sameTime(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+func createUser(t *testing.T, s Stores, email string) *types.User {
+	t.Helper()
+
+	if err := s.Users.Create(email, []byte("hash")); err != nil {
+		t.Fatalf("Create(%q): %v", email, err)
+	}
+	u, err := s.Users.GetByEmail(email)
+	if err != nil {
+		t.Fatalf("GetByEmail(%q): %v", email, err)
+	}
+
+	return u
+}
+
+func testUsers(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+
+	if u.Role != types.RoleUser || u.Profile != storage.DefaultProfile || u.VerifiedAt != nil || u.DisabledAt != nil {
+		t.Errorf("new user = %+v, want role user, the default profile and no timestamps", u)
+	}
+	if string(u.Password) != "hash" {
+		t.Errorf("Password = %q, want %q", u.Password, "hash")
+	}
+
+	if err := s.Users.Create("ann@example.com", []byte("x")); !errors.Is(err, storage.ErrDuplicate) {
+		t.Errorf("Create of a taken email = %v, want ErrDuplicate", err)
+	}
+	if _, err := s.Users.GetById(u.ID + other.ID + 100); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetById of a missing user = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Users.GetByEmail("nobody@example.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByEmail of a missing user = %v, want ErrNotFound", err)
+	}
+
+	p := types.Profile{DisplayName: "Ann", TimeZone: "Europe/Berlin", Locale: "de-DE", WeekStart: "sunday", AvatarURL: "https://example.com/a.png"}
+	now := time.Now().UTC()
+	for _, err := range []error{
+		s.Users.EditPassword(u.ID, []byte("new hash")),
+		s.Users.EditProfile(u.ID, p),
+		s.Users.SetRole(u.ID, types.RoleSupport),
+		s.Users.SetDisabled(u.ID, &now),
+		s.Users.Verify(u.ID, now),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := s.Users.GetById(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got.Password) != "new hash" || got.Profile != p || got.Role != types.RoleSupport {
+		t.Errorf("edited user = %+v", got)
+	}
+	if got.DisabledAt == nil || !sameTime(*got.DisabledAt, now) || got.VerifiedAt == nil || !sameTime(*got.VerifiedAt, now) {
+		t.Errorf("DisabledAt = %v, VerifiedAt = %v, want %s", got.DisabledAt, got.VerifiedAt, now)
+	}
+	if n, err := s.Users.CountEnabled(types.RoleSupport); err != nil || n != 0 {
+		t.Errorf("CountEnabled with the support user disabled = %d, %v, want 0", n, err)
+	}
+
+	if err = s.Users.SetDisabled(u.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ = s.Users.GetById(u.ID); got.DisabledAt != nil {
+		t.Errorf("DisabledAt = %v after enabling", got.DisabledAt)
+	}
+	for role, want := range map[string]int{types.RoleSupport: 1, types.RoleUser: 1, types.RoleAdmin: 0} {
+		if n, err := s.Users.CountEnabled(role); err != nil || n != want {
+			t.Errorf("CountEnabled(%s) = %d, %v, want %d", role, n, err, want)
+		}
+	}
+
+	if err = s.Users.EditEmail(u.ID, "bob@example.com"); !errors.Is(err, storage.ErrDuplicate) {
+		t.Errorf("EditEmail to a taken email = %v, want ErrDuplicate", err)
+	}
+	if err = s.Users.EditEmail(other.ID, "robert@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.Users.GetByEmail("robert@example.com")
+	if err != nil || got.ID != other.ID || got.VerifiedAt == nil {
+		t.Errorf("GetByEmail after EditEmail = %+v, %v, want user %d verified", got, err, other.ID)
+	}
+}
+
+func testUserSearch(t *testing.T, s Stores) {
+	a := createUser(t, s, "a_1@example.com")
+	b := createUser(t, s, "ab1@example.com")
+	c := createUser(t, s, "carol@example.org")
+	p := storage.DefaultProfile
+	p.DisplayName = "Carol 100%"
+	if err := s.Users.EditProfile(c.ID, p); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []uint64
+	}{
+		{"", []uint64{a.ID, b.ID, c.ID}},
+		{"EXAMPLE.COM", []uint64{a.ID, b.ID}},
+		// LIKE wildcards match themselves only.
+		{"a_", []uint64{a.ID}},
+		{"100%", []uint64{c.ID}},
+		{"carol 1", []uint64{c.ID}},
+		{"nobody", nil},
+	}
+	for _, tt := range tests {
+		data, err := s.Users.Search(tt.query, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []uint64
+		for _, u := range data.Items {
+			ids = append(ids, u.ID)
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, ids, tt.want)
+		}
+	}
+
+	data, err := s.Users.Search("", 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Items) != 1 || data.Items[0].ID != c.ID ||
+		!reflect.DeepEqual(data.Pagination, types.Pagination{Prev: []int{1}, Next: []int{}}) {
+		t.Errorf("Search page 2 = %+v", data)
+	}
+}
+
+func testUserDelete(t *testing.T, s Stores) {
+	u := createUser(t, s, "gone@example.com")
+	keep := createUser(t, s, "kept@example.com")
+
+	expire := time.Now().UTC().Add(time.Hour)
+	for _, id := range []uint64{u.ID, keep.ID} {
+		if err := s.Todos.Create("todo", "", expire, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Tokens.Create("session", u.ID, expire, "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PersonalTokens.Create("pat_x", "ci", []string{"todos:read"}, nil, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, owner := range []*types.User{u, keep} {
+		err := s.AuthEvents.Record(types.AuthEvent{
+			UserID: &owner.ID, Email: owner.Email, Type: types.EventLogin, Outcome: types.OutcomeSuccess,
+			IP: "10.0.0.1", UserAgent: "curl", Created: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Impersonations.Create("imp_x", keep.ID, u.ID, "ticket about ann", expire); err != nil {
+		t.Fatal(err)
+	}
+	imp, err := s.Impersonations.GetByToken("imp_x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Impersonations.Record(types.ImpersonationAudit{
+		ImpersonationID: imp.ID, AdminID: keep.ID, UserID: u.ID, Action: types.AuditStart, Created: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usage, err := s.Users.Usage(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *usage != (types.Usage{Todos: 1, Sessions: 1, PersonalTokens: 1}) {
+		t.Errorf("Usage = %+v", usage)
+	}
+	total, err := s.Users.TotalUsage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total.Users != 2 || total.Todos != 2 {
+		t.Errorf("TotalUsage = %+v", total)
+	}
+
+	past := time.Now().UTC().Add(-time.Minute)
+	if err = s.Users.ScheduleDeletion(u.ID, &past); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().UTC().Add(time.Hour)
+	if err = s.Users.ScheduleDeletion(keep.ID, &future); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Users.PurgeDeleted()
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeleted = %d, %v, want 1", n, err)
+	}
+	if _, err = s.Users.GetById(u.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetById after purge = %v, want ErrNotFound", err)
+	}
+	if _, err = s.Tokens.GetByToken("session"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("session after purge = %v, want ErrNotFound", err)
+	}
+	if _, err = s.PersonalTokens.GetByToken("pat_x"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("personal token after purge = %v, want ErrNotFound", err)
+	}
+	if todos, _ := s.Todos.GetAllByUser(u.ID); len(todos) != 0 {
+		t.Errorf("todos after purge = %v", todos)
+	}
+	if todos, _ := s.Todos.GetAllByUser(keep.ID); len(todos) != 1 {
+		t.Errorf("todos of another user after purge = %v, want 1", todos)
+	}
+
+	// The logs outlive the user without pointing to them.
+	events, err := s.AuthEvents.Search(types.AuthEventFilter{}, 1, 10)
+	if err != nil || len(events.Items) != 2 {
+		t.Fatalf("events after purge = %+v, %v, want 2", events, err)
+	}
+	for _, e := range events.Items {
+		deleted := e.UserID == nil
+		if deleted != (e.Email == "") || deleted != (e.IP == "") || deleted != (e.UserAgent == "") {
+			t.Errorf("event after purge = %+v, want the deleted user's event redacted", e)
+		}
+	}
+	if events.Items[0].UserID == nil || *events.Items[0].UserID != keep.ID {
+		t.Errorf("event of another user after purge = %+v", events.Items[0])
+	}
+	if imp, err = s.Impersonations.GetById(imp.ID); err != nil || imp.UserID != 0 || imp.Reason != "" || imp.AdminID != keep.ID {
+		t.Errorf("impersonation after purge = %+v, %v, want the user detached", imp, err)
+	}
+	if audit, err := s.Impersonations.GetAudit(imp.ID); err != nil || len(audit) != 1 || audit[0].UserID != 0 {
+		t.Errorf("audit after purge = %+v, %v, want the user detached", audit, err)
+	}
+
+	if err = s.Users.Delete(keep.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Users.GetById(keep.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetById after Delete = %v, want ErrNotFound", err)
+	}
+	if imp, err = s.Impersonations.GetById(imp.ID); err != nil || imp.AdminID != 0 {
+		t.Errorf("impersonation after deleting the admin = %+v, %v, want the admin detached", imp, err)
+	}
+	if audit, err := s.Impersonations.GetAudit(imp.ID); err != nil || len(audit) != 1 || audit[0].AdminID != 0 {
+		t.Errorf("audit after deleting the admin = %+v, %v, want the admin detached", audit, err)
+	}
+}
+
+func testTodos(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+	expire := time.Date(2030, 6, 1, 12, 0, 0, 0, berlin)
+	if err = s.Todos.Create("title", "note", expire, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	todos, err := s.Todos.GetAllByUser(u.ID)
+	if err != nil || len(todos) != 1 {
+		t.Fatalf("GetAllByUser = %v, %v", todos, err)
+	}
+	todo := todos[0]
+	if todo.Title != "title" || todo.Note != "note" || todo.Status != "active" || todo.UserID != u.ID {
+		t.Errorf("todo = %+v", todo)
+	}
+	if !todo.Expire.Equal(expire) || todo.Expire.Location() != time.UTC {
+		t.Errorf("Expire = %s, want %s in UTC", todo.Expire, expire.UTC())
+	}
+
+	if _, err = s.Todos.GetByUserId(todo.ID, other.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByUserId of another user's todo = %v, want ErrNotFound", err)
+	}
+
+	// Writes with the wrong user change nothing.
+	if err = s.Todos.Edit("stolen", "", expire, todo.ID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Todos.EditStatus(todo.ID, other.ID, "completed"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Todos.GetByUserId(todo.ID, u.ID)
+	if err != nil || got.Title != "title" || got.Status != "active" {
+		t.Errorf("todo after another user's edit = %+v, %v", got, err)
+	}
+
+	newExpire := time.Date(2031, 1, 1, 9, 30, 0, 0, berlin)
+	if err = s.Todos.Edit("new", "new note", newExpire, todo.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Todos.EditStatus(todo.ID, u.ID, "completed"); err != nil {
+		t.Fatal(err)
+	}
+	got, err = s.Todos.GetByUserId(todo.ID, u.ID)
+	if err != nil || got.Title != "new" || got.Note != "new note" || got.Status != "completed" ||
+		!got.Expire.Equal(newExpire) || got.Expire.Location() != time.UTC {
+		t.Errorf("edited todo = %+v, %v", got, err)
+	}
+
+	s.Todos.Delete(todo.ID)
+	if _, err = s.Todos.GetByUserId(todo.ID, u.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByUserId after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func testTodoPages(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+
+	expire := time.Now().UTC().Add(time.Hour)
+	for _, title := range []string{"1", "2", "3", "4", "5"} {
+		if err := s.Todos.Create(title, "", expire, u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Todos.Create("other", "", expire, other.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		page, limit int
+		titles      []string
+		pagination  types.Pagination
+	}{
+		{1, 2, []string{"5", "4"}, types.Pagination{Prev: []int{}, Next: []int{2}}},
+		{2, 2, []string{"3", "2"}, types.Pagination{Prev: []int{1}, Next: []int{3}}},
+		{3, 2, []string{"1"}, types.Pagination{Prev: []int{2}, Next: []int{}}},
+		{4, 2, nil, types.Pagination{Prev: []int{3}, Next: []int{}}},
+		{1, 10, []string{"5", "4", "3", "2", "1"}, types.Pagination{Prev: []int{}, Next: []int{}}},
+	}
+	for _, tt := range tests {
+		data, err := s.Todos.GetTodosByPage(u.ID, tt.page, tt.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, todo := range data.Items {
+			titles = append(titles, todo.Title)
+		}
+		if !reflect.DeepEqual(titles, tt.titles) || !reflect.DeepEqual(data.Pagination, tt.pagination) {
+			t.Errorf("GetTodosByPage(page %d, limit %d) = %v %+v, want %v %+v",
+				tt.page, tt.limit, titles, data.Pagination, tt.titles, tt.pagination)
+		}
+		if data.Items == nil {
+			t.Errorf("GetTodosByPage(page %d, limit %d) items are nil, want an empty list", tt.page, tt.limit)
+		}
+	}
+
+	data, err := s.Todos.GetTodosByPage(other.ID, 1, 10)
+	if err != nil || len(data.Items) != 1 || data.Items[0].Title != "other" {
+		t.Errorf("other user's todos = %+v, %v", data, err)
+	}
+}
+
+func testTodoStatus(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+
+	past := time.Now().UTC().Add(-time.Hour)
+	future := time.Now().UTC().Add(time.Hour)
+	for _, c := range []struct {
+		title  string
+		expire time.Time
+	}{{"late", past}, {"done", past}, {"ok", future}} {
+		if err := s.Todos.Create(c.title, "", c.expire, u.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	todos, _ := s.Todos.GetAllByUser(u.ID)
+	for _, todo := range todos {
+		if todo.Title == "done" {
+			if err := s.Todos.EditStatus(todo.ID, u.ID, "completed"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	s.Todos.CheckTodoStatus()
+
+	want := map[string]string{"late": "overdue", "done": "completed", "ok": "active"}
+	todos, _ = s.Todos.GetAllByUser(u.ID)
+	for _, todo := range todos {
+		if todo.Status != want[todo.Title] {
+			t.Errorf("status of %q = %q, want %q", todo.Title, todo.Status, want[todo.Title])
+		}
+	}
+
+	// A deadline moved into the future makes the todo active again.
+	for _, todo := range todos {
+		if todo.Title == "late" {
+			if err := s.Todos.Edit(todo.Title, "", future, todo.ID, u.ID); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	n, err := s.Todos.RecomputeStatus()
+	if err != nil || n != 1 {
+		t.Errorf("RecomputeStatus = %d, %v, want 1", n, err)
+	}
+}
+
+func testTokens(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+
+	expire := time.Now().UTC().Add(time.Hour)
+	for _, token := range []string{"first", "second", "third"} {
+		if err := s.Tokens.Create(token, u.ID, expire, "agent", "127.0.0.1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Tokens.Create("others", other.ID, expire, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := s.Tokens.GetByToken("first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.UserID != u.ID || first.UserAgent != "agent" || first.IP != "127.0.0.1" ||
+		first.TokenHash != storage.HashToken("first") || !sameTime(first.Expire, expire) {
+		t.Errorf("token = %+v", first)
+	}
+	if _, err = s.Tokens.GetByToken(first.TokenHash); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByToken of a digest = %v, want ErrNotFound", err)
+	}
+	if _, err = s.Tokens.GetByUserId(first.ID, other.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByUserId of another user's token = %v, want ErrNotFound", err)
+	}
+
+	if err = s.Tokens.EditName(first.ID, u.ID, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().UTC().Add(time.Minute)
+	if err = s.Tokens.Touch(first.ID, later, later.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	first, _ = s.Tokens.GetByToken("first")
+	if first.Name != "laptop" || !sameTime(first.LastUsed, later) || !sameTime(first.Expire, later.Add(time.Hour)) {
+		t.Errorf("token after EditName and Touch = %+v", first)
+	}
+
+	// The most recently used session comes first.
+	tokens, err := s.Tokens.GetAllByUser(u.ID)
+	if err != nil || len(tokens) != 3 || tokens[0].ID != first.ID {
+		t.Errorf("GetAllByUser = %+v, %v, want 3 starting with %d", tokens, err, first.ID)
+	}
+
+	n, err := s.Tokens.DeleteOthers(u.ID, first.ID)
+	if err != nil || n != 2 {
+		t.Errorf("DeleteOthers = %d, %v, want 2", n, err)
+	}
+	if _, err = s.Tokens.GetByToken("others"); err != nil {
+		t.Errorf("another user's token after DeleteOthers: %v", err)
+	}
+
+	s.Tokens.Delete("first")
+	if _, err = s.Tokens.GetByToken("first"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByToken after Delete = %v, want ErrNotFound", err)
+	}
+	if n, err = s.Tokens.DeleteByUser(other.ID); err != nil || n != 1 {
+		t.Errorf("DeleteByUser = %d, %v, want 1", n, err)
+	}
+
+	if err = s.Tokens.Deny("digest", expire); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Tokens.Deny("digest", expire); err != nil {
+		t.Errorf("Deny of a denied digest: %v", err)
+	}
+	denied, err := s.Tokens.GetDenied()
+	if err != nil || len(denied) != 1 || !sameTime(denied["digest"], expire) {
+		t.Errorf("GetDenied = %v, %v", denied, err)
+	}
+}
+
+func testRefreshTokens(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+
+	now := time.Now().UTC()
+	expire, sessionExpire := now.Add(time.Minute), now.Add(time.Hour)
+	if err := s.Tokens.CreateWithRefresh("access", "refresh", u.ID, expire, sessionExpire, "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := s.Tokens.GetByToken("access")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.SessionExpire == nil || !sameTime(*session.SessionExpire, sessionExpire) {
+		t.Errorf("SessionExpire = %v, want %s", session.SessionExpire, sessionExpire)
+	}
+
+	rt, err := s.Tokens.GetRefresh("refresh")
+	if err != nil || rt.SessionID != session.ID || rt.UserID != u.ID || rt.Used {
+		t.Fatalf("GetRefresh = %+v, %v", rt, err)
+	}
+
+	rotated, err := s.Tokens.Rotate(rt.ID, session.ID, "access 2", "refresh 2", expire.Add(time.Minute), sessionExpire)
+	if err != nil || !rotated {
+		t.Fatalf("Rotate = %t, %v, want true", rotated, err)
+	}
+	if _, err = s.Tokens.GetByToken("access"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("old access token after Rotate = %v, want ErrNotFound", err)
+	}
+	if got, err := s.Tokens.GetByToken("access 2"); err != nil || got.ID != session.ID {
+		t.Errorf("new access token = %+v, %v, want session %d", got, err, session.ID)
+	}
+	if rt, err = s.Tokens.GetRefresh("refresh"); err != nil || !rt.Used {
+		t.Errorf("old refresh token = %+v, %v, want used", rt, err)
+	}
+	if next, err := s.Tokens.GetRefresh("refresh 2"); err != nil || next.Used || next.SessionID != session.ID {
+		t.Errorf("new refresh token = %+v, %v", next, err)
+	}
+
+	// A replayed refresh token rotates nothing.
+	rotated, err = s.Tokens.Rotate(rt.ID, session.ID, "access 3", "refresh 3", expire, sessionExpire)
+	if err != nil || rotated {
+		t.Errorf("Rotate of a used refresh token = %t, %v, want false", rotated, err)
+	}
+	if _, err = s.Tokens.GetByToken("access 3"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("access token of a refused rotation = %v, want ErrNotFound", err)
+	}
+}
+
+func testPersonalTokens(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+
+	scopes := []string{"todos:read", "todos:write"}
+	expire := time.Now().UTC().Add(24 * time.Hour)
+	if err := s.PersonalTokens.Create("pat_a", "ci", scopes, nil, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.PersonalTokens.Create("pat_b", "cron", scopes[:1], &expire, u.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := s.PersonalTokens.GetByToken("pat_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Name != "ci" || !reflect.DeepEqual(a.Scopes, scopes) || a.Expire != nil || a.LastUsed != nil || a.UserID != u.ID {
+		t.Errorf("token = %+v", a)
+	}
+	b, err := s.PersonalTokens.GetByToken("pat_b")
+	if err != nil || b.Expire == nil || !sameTime(*b.Expire, expire) {
+		t.Errorf("token with expiry = %+v, %v", b, err)
+	}
+
+	tokens, err := s.PersonalTokens.GetAllByUser(u.ID)
+	if err != nil || len(tokens) != 2 || tokens[0].ID != b.ID {
+		t.Errorf("GetAllByUser = %+v, %v, want the newest first", tokens, err)
+	}
+
+	now := time.Now().UTC()
+	if err = s.PersonalTokens.Touch(a.ID, now); err != nil {
+		t.Fatal(err)
+	}
+	if a, _ = s.PersonalTokens.GetByToken("pat_a"); a.LastUsed == nil || !sameTime(*a.LastUsed, now) {
+		t.Errorf("LastUsed = %v, want %s", a.LastUsed, now)
+	}
+
+	if _, err = s.PersonalTokens.GetByUserId(a.ID, other.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByUserId of another user's token = %v, want ErrNotFound", err)
+	}
+	if err = s.PersonalTokens.Delete(a.ID, u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.PersonalTokens.GetByToken("pat_a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetByToken after Delete = %v, want ErrNotFound", err)
+	}
+
+	if err = s.PersonalTokens.Create("pat_c", "other", scopes, nil, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.PersonalTokens.DeleteByUser(u.ID); err != nil || n != 1 {
+		t.Errorf("DeleteByUser = %d, %v, want 1", n, err)
+	}
+	if _, err = s.PersonalTokens.GetByToken("pat_c"); err != nil {
+		t.Errorf("DeleteByUser removed another user's token: %v", err)
+	}
+}
+
+func testTwoFactor(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+
+	if _, err := s.TwoFactor.Get(u.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get before SetSecret = %v, want ErrNotFound", err)
+	}
+	if err := s.TwoFactor.SetSecret(u.ID, "old secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.TwoFactor.SetSecret(u.ID, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	tf, err := s.TwoFactor.Get(u.ID)
+	if err != nil || tf.Secret != "secret" || tf.Enabled {
+		t.Fatalf("Get = %+v, %v, want the new unconfirmed secret", tf, err)
+	}
+
+	if err = s.TwoFactor.Enable(u.ID, 10, []string{"code-1", "code-2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.TwoFactor.Enable(u.ID, 11, nil); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("second Enable = %v, want ErrNotFound", err)
+	}
+	if tf, _ = s.TwoFactor.Get(u.ID); !tf.Enabled || tf.LastStep != 10 {
+		t.Errorf("Get after Enable = %+v", tf)
+	}
+
+	for _, c := range []struct {
+		step int64
+		want bool
+	}{{9, false}, {10, false}, {11, true}, {11, false}} {
+		if ok, err := s.TwoFactor.UseStep(u.ID, c.step); err != nil || ok != c.want {
+			t.Errorf("UseStep(%d) = %t, %v, want %t", c.step, ok, err, c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		code string
+		want bool
+	}{{"code-1", true}, {"code-1", false}, {"code-3", false}} {
+		if ok, err := s.TwoFactor.UseRecoveryCode(u.ID, c.code); err != nil || ok != c.want {
+			t.Errorf("UseRecoveryCode(%q) = %t, %v, want %t", c.code, ok, err, c.want)
+		}
+	}
+	if n, err := s.TwoFactor.CountRecoveryCodes(u.ID); err != nil || n != 1 {
+		t.Errorf("CountRecoveryCodes = %d, %v, want 1", n, err)
+	}
+
+	if err = s.TwoFactor.CreateChallenge("challenge", u.ID, time.Now().UTC().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.TwoFactor.GetChallenge("challenge")
+	if err != nil || c.UserID != u.ID || c.Attempts != 0 {
+		t.Fatalf("GetChallenge = %+v, %v", c, err)
+	}
+	if err = s.TwoFactor.FailChallenge(c.ID); err != nil {
+		t.Fatal(err)
+	}
+	if c, _ = s.TwoFactor.GetChallenge("challenge"); c.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1", c.Attempts)
+	}
+	if ok, err := s.TwoFactor.DeleteChallenge(c.ID); err != nil || !ok {
+		t.Errorf("DeleteChallenge = %t, %v, want true", ok, err)
+	}
+	if ok, err := s.TwoFactor.DeleteChallenge(c.ID); err != nil || ok {
+		t.Errorf("second DeleteChallenge = %t, %v, want false", ok, err)
+	}
+
+	if err = s.TwoFactor.CreateChallenge("pending", u.ID, time.Now().UTC().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.TwoFactor.Disable(u.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.TwoFactor.Get(u.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get after Disable = %v, want ErrNotFound", err)
+	}
+	if _, err = s.TwoFactor.GetChallenge("pending"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("challenge after Disable = %v, want ErrNotFound", err)
+	}
+	if n, _ := s.TwoFactor.CountRecoveryCodes(u.ID); n != 0 {
+		t.Errorf("recovery codes after Disable = %d, want 0", n)
+	}
+}
+
+func testAttempts(t *testing.T, s Stores) {
+	if _, err := s.Attempts.Get("account:a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get of an unknown key = %v, want ErrNotFound", err)
+	}
+
+	window := time.Now().UTC().Add(time.Hour)
+	for want := 1; want <= 3; want++ {
+		if n, err := s.Attempts.Fail("account:a", window); err != nil || n != want {
+			t.Errorf("Fail = %d, %v, want %d", n, err, want)
+		}
+	}
+	if n, err := s.Attempts.Fail("ip:1", window); err != nil || n != 1 {
+		t.Errorf("Fail of another key = %d, %v, want 1", n, err)
+	}
+
+	until := time.Now().UTC().Add(time.Minute)
+	if err := s.Attempts.Lock("account:a", until); err != nil {
+		t.Fatal(err)
+	}
+	a, err := s.Attempts.Get("account:a")
+	if err != nil || a.Failures != 3 || a.LockedUntil == nil || !sameTime(*a.LockedUntil, until) {
+		t.Errorf("Get = %+v, %v", a, err)
+	}
+
+	if err = s.Attempts.Reset("account:a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Attempts.Get("account:a"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get after Reset = %v, want ErrNotFound", err)
+	}
+
+	// Failures that expired are forgotten.
+	if _, err = s.Attempts.Fail("ip:2", time.Now().UTC().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Attempts.Fail("ip:2", window); err != nil || n != 1 {
+		t.Errorf("Fail after the window = %d, %v, want 1", n, err)
+	}
+}
+
+func testPasswordResets(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+	other := createUser(t, s, "bob@example.com")
+
+	expire := time.Now().UTC().Add(time.Hour)
+	for _, token := range []string{"reset 1", "reset 2"} {
+		if err := s.PasswordResets.Create(token, u.ID, expire); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := s.PasswordResets.GetByToken("reset 1")
+	if err != nil || r.UserID != u.ID || r.Used || !sameTime(r.Expire, expire) {
+		t.Fatalf("GetByToken = %+v, %v", r, err)
+	}
+	if ok, err := s.PasswordResets.Use(r.ID, other.ID); err != nil || ok {
+		t.Errorf("Use by another user = %t, %v, want false", ok, err)
+	}
+	if ok, err := s.PasswordResets.Use(r.ID, u.ID); err != nil || !ok {
+		t.Errorf("Use = %t, %v, want true", ok, err)
+	}
+	if ok, err := s.PasswordResets.Use(r.ID, u.ID); err != nil || ok {
+		t.Errorf("second Use = %t, %v, want false", ok, err)
+	}
+	if r, err = s.PasswordResets.GetByToken("reset 1"); err != nil || !r.Used {
+		t.Errorf("used reset = %+v, %v", r, err)
+	}
+	if _, err = s.PasswordResets.GetByToken("reset 2"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("other reset after Use = %v, want ErrNotFound", err)
+	}
+}
+
+func testEmailChanges(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+
+	expire := time.Now().UTC().Add(time.Hour)
+	err := s.EmailChanges.Create("change", types.EmailChangeConfirm, u.ID, "ann@example.com", "anna@example.com", expire)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := s.EmailChanges.GetByToken("change")
+	if err != nil || c.Kind != types.EmailChangeConfirm || c.UserID != u.ID ||
+		c.OldEmail != "ann@example.com" || c.NewEmail != "anna@example.com" || c.Used {
+		t.Fatalf("GetByToken = %+v, %v", c, err)
+	}
+	if ok, err := s.EmailChanges.Use(c.ID); err != nil || !ok {
+		t.Errorf("Use = %t, %v, want true", ok, err)
+	}
+	if ok, err := s.EmailChanges.Use(c.ID); err != nil || ok {
+		t.Errorf("second Use = %t, %v, want false", ok, err)
+	}
+}
+
+func testImpersonations(t *testing.T, s Stores) {
+	admin := createUser(t, s, "admin@example.com")
+	u := createUser(t, s, "ann@example.com")
+
+	expire := time.Now().UTC().Add(30 * time.Minute)
+	if err := s.Impersonations.Create("imp_x", admin.ID, u.ID, "ticket 1", expire); err != nil {
+		t.Fatal(err)
+	}
+	imp, err := s.Impersonations.GetByToken("imp_x")
+	if err != nil || imp.AdminID != admin.ID || imp.UserID != u.ID || imp.Reason != "ticket 1" ||
+		imp.Ended != nil || !sameTime(imp.Expire, expire) {
+		t.Fatalf("GetByToken = %+v, %v", imp, err)
+	}
+	if got, err := s.Impersonations.GetById(imp.ID); err != nil || got.ID != imp.ID {
+		t.Errorf("GetById = %+v, %v", got, err)
+	}
+
+	for _, action := range []string{types.AuditStart, types.AuditRequest} {
+		err = s.Impersonations.Record(types.ImpersonationAudit{
+			ImpersonationID: imp.ID, AdminID: admin.ID, UserID: u.ID, Action: action,
+			Method: "GET", Path: "/api/auth", Status: 200, Created: time.Now().UTC(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	other := createUser(t, s, "bob@example.com")
+	if err = s.Impersonations.Create("imp_y", admin.ID, other.ID, "", expire); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Impersonations.Create("imp_old", admin.ID, u.ID, "", time.Now().UTC().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		userId uint64
+		want   int
+	}{{admin.ID, 2}, {u.ID, 1}, {other.ID, 1}} {
+		if active, err := s.Impersonations.GetActiveByUser(tt.userId, time.Now().UTC()); err != nil || len(active) != tt.want {
+			t.Errorf("GetActiveByUser(%d) = %+v, %v, want %d", tt.userId, active, err, tt.want)
+		}
+	}
+
+	now := time.Now().UTC()
+	if ok, err := s.Impersonations.End(imp.ID, now); err != nil || !ok {
+		t.Errorf("End = %t, %v, want true", ok, err)
+	}
+	if ok, err := s.Impersonations.End(imp.ID, now); err != nil || ok {
+		t.Errorf("second End = %t, %v, want false", ok, err)
+	}
+	if imp, _ = s.Impersonations.GetById(imp.ID); imp.Ended == nil || !sameTime(*imp.Ended, now) {
+		t.Errorf("Ended = %v, want %s", imp.Ended, now)
+	}
+	if active, err := s.Impersonations.GetActiveByUser(u.ID, now); err != nil || len(active) != 0 {
+		t.Errorf("GetActiveByUser after End = %+v, %v, want none", active, err)
+	}
+
+	audit, err := s.Impersonations.GetAudit(imp.ID)
+	if err != nil || len(audit) != 2 || audit[0].Action != types.AuditStart || audit[1].Status != 200 {
+		t.Errorf("GetAudit = %+v, %v", audit, err)
+	}
+}
+
+func testAuthEvents(t *testing.T, s Stores) {
+	u := createUser(t, s, "ann@example.com")
+
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	events := []types.AuthEvent{
+		{UserID: &u.ID, Email: "ann@example.com", Type: types.EventLogin, Outcome: types.OutcomeFailure, Reason: "invalid_credentials", IP: "10.0.0.1"},
+		{Email: "nobody@example.com", Type: types.EventLogin, Outcome: types.OutcomeFailure, Reason: "invalid_credentials", IP: "10.0.0.2"},
+		{UserID: &u.ID, Email: "ann@example.com", Type: types.EventLogin, Outcome: types.OutcomeSuccess, IP: "10.0.0.1", UserAgent: "curl"},
+		{UserID: &u.ID, Email: "ann@example.com", Type: types.EventLogout, Outcome: types.OutcomeSuccess, IP: "10.0.0.1"},
+	}
+	for i, e := range events {
+		e.Created = base.Add(time.Duration(i) * time.Minute)
+		if err := s.AuthEvents.Record(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	since, until := base.Add(time.Minute), base.Add(3*time.Minute)
+	tests := []struct {
+		name   string
+		filter types.AuthEventFilter
+		want   []string // emails and types, newest first
+	}{
+		{"all", types.AuthEventFilter{}, []string{"ann logout", "ann login", "nobody login", "ann login"}},
+		{"user", types.AuthEventFilter{UserID: u.ID}, []string{"ann logout", "ann login", "ann login"}},
+		{"email ignores case", types.AuthEventFilter{Email: "NOBODY@example.com"}, []string{"nobody login"}},
+		{"type and outcome", types.AuthEventFilter{Type: types.EventLogin, Outcome: types.OutcomeFailure}, []string{"nobody login", "ann login"}},
+		{"ip", types.AuthEventFilter{IP: "10.0.0.2"}, []string{"nobody login"}},
+		{"time range", types.AuthEventFilter{Since: &since, Until: &until}, []string{"ann login", "nobody login"}},
+	}
+	for _, tt := range tests {
+		data, err := s.AuthEvents.Search(tt.filter, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range data.Items {
+			name := "nobody"
+			if e.UserID != nil && *e.UserID == u.ID {
+				name = "ann"
+			}
+			got = append(got, name+" "+e.Type)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Search(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	data, err := s.AuthEvents.Search(types.AuthEventFilter{}, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Items) != 1 || !reflect.DeepEqual(data.Pagination, types.Pagination{Prev: []int{1}, Next: []int{}}) {
+		t.Errorf("Search page 2 = %+v", data)
+	}
+	e := data.Items[0]
+	if e.Reason != "invalid_credentials" || e.IP != "10.0.0.1" || !e.Created.Equal(base) || e.Created.Location() != time.UTC {
+		t.Errorf("oldest event = %+v", e)
+	}
+
+	n, err := s.AuthEvents.DeleteBefore(base.Add(2 * time.Minute))
+	if err != nil || n != 2 {
+		t.Errorf("DeleteBefore = %d, %v, want 2", n, err)
+	}
+	if data, _ = s.AuthEvents.Search(types.AuthEventFilter{}, 1, 10); len(data.Items) != 2 {
+		t.Errorf("events after DeleteBefore = %d, want 2", len(data.Items))
+	}
+}
@@ -6,13 +6,237 @@ type User struct {
 	ID       uint64 `json:"id"`
 	Email    string `json:"email"`
 	Password []byte `json:"-"`
+	// VerifiedAt is nil until the user confirms their email address.
+	VerifiedAt *time.Time `json:"verified_at"`
+	// DeleteAfter is set while the user's account is scheduled for deletion.
+	DeleteAfter *time.Time `json:"delete_after,omitempty"`
+	Role        string     `json:"role"`
+	// DisabledAt is set while an administrator has disabled the account.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	Profile
+}
+
+// Roles of users.
+const (
+	RoleUser    = "user"
+	RoleSupport = "support"
+	RoleAdmin   = "admin"
+)
+
+// UserData is a page of users in the admin API.
+type UserData struct {
+	Items      []User     `json:"items"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// Usage counts what a user, or every user, has stored.
+type Usage struct {
+	Todos          int `json:"todos"`
+	Sessions       int `json:"sessions"`
+	PersonalTokens int `json:"personal_tokens"`
+}
+
+// TotalUsage is the usage of all users together.
+type TotalUsage struct {
+	Users         int `json:"users"`
+	DisabledUsers int `json:"disabled_users"`
+	Usage
+}
+
+// Profile holds the settings a user can change about themselves.
+type Profile struct {
+	DisplayName string `json:"display_name"`
+	// TimeZone is an IANA time zone name such as "Europe/Berlin".
+	TimeZone string `json:"time_zone"`
+	// Locale is a BCP 47 language tag such as "en-US".
+	Locale string `json:"locale"`
+	// WeekStart is the lowercase English name of the first day of the week.
+	WeekStart string `json:"week_start"`
+	AvatarURL string `json:"avatar_url"`
 }
 
 type Token struct {
-	ID     uint64    `json:"id"`
-	Token  string    `json:"token"`
+	ID        uint64    `json:"id"`
+	TokenHash string    `json:"-"`
+	Name      string    `json:"name"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	Created   time.Time `json:"created"`
+	LastUsed  time.Time `json:"last_used"`
+	Expire    time.Time `json:"expire"`
+	// SessionExpire is set for sessions that are renewed with refresh tokens,
+	// in which case Expire only covers the current short-lived access token.
+	SessionExpire *time.Time `json:"session_expire,omitempty"`
+	UserID        uint64     `json:"user_id"`
+}
+
+type RefreshToken struct {
+	ID        uint64    `json:"id"`
+	TokenHash string    `json:"-"`
+	SessionID uint64    `json:"session_id"`
+	UserID    uint64    `json:"user_id"`
+	Created   time.Time `json:"created"`
+	Used      bool      `json:"used"`
+}
+
+type PersonalToken struct {
+	ID        uint64     `json:"id"`
+	TokenHash string     `json:"-"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	Created   time.Time  `json:"created"`
+	LastUsed  *time.Time `json:"last_used"`
+	Expire    *time.Time `json:"expire"`
+	UserID    uint64     `json:"user_id"`
+}
+
+// TwoFactor holds a user's TOTP secret. It is not Enabled until the user
+// confirms the enrollment with a first code.
+type TwoFactor struct {
+	UserID  uint64 `json:"user_id"`
+	Secret  string `json:"-"`
+	Enabled bool   `json:"enabled"`
+	// LastStep is the last TOTP time step that was accepted, so a code
+	// cannot be used twice.
+	LastStep int64     `json:"-"`
+	Created  time.Time `json:"created"`
+}
+
+// LoginChallenge is handed out by a login with a correct password when the
+// user has two-factor authentication enabled.
+type LoginChallenge struct {
+	ID        uint64    `json:"id"`
+	TokenHash string    `json:"-"`
+	UserID    uint64    `json:"user_id"`
+	Attempts  int       `json:"attempts"`
+	Expire    time.Time `json:"expire"`
+}
+
+// LoginAttempt counts failed logins for an account or an IP address.
+type LoginAttempt struct {
+	Key         string     `json:"key"`
+	Failures    int        `json:"failures"`
+	LockedUntil *time.Time `json:"locked_until"`
+	// Expire is when the failures are forgotten if no other attempt fails.
 	Expire time.Time `json:"expire"`
-	UserID uint64    `json:"user_id"`
+}
+
+// PasswordReset is a single-use token emailed to a user who forgot their
+// password.
+type PasswordReset struct {
+	ID        uint64    `json:"id"`
+	TokenHash string    `json:"-"`
+	UserID    uint64    `json:"user_id"`
+	Created   time.Time `json:"created"`
+	Expire    time.Time `json:"expire"`
+	Used      bool      `json:"used"`
+}
+
+// Kinds of email change tokens.
+const (
+	// EmailChangeConfirm is sent to the new address and applies the change.
+	EmailChangeConfirm = "confirm"
+	// EmailChangeRevert is sent to the old address and undoes the change.
+	EmailChangeRevert = "revert"
+)
+
+type EmailChange struct {
+	ID        uint64    `json:"id"`
+	TokenHash string    `json:"-"`
+	Kind      string    `json:"kind"`
+	UserID    uint64    `json:"user_id"`
+	OldEmail  string    `json:"old_email"`
+	NewEmail  string    `json:"new_email"`
+	Created   time.Time `json:"created"`
+	Expire    time.Time `json:"expire"`
+	Used      bool      `json:"used"`
+}
+
+// Impersonation lets an administrator act as another user for a limited
+// time to reproduce a problem.
+type Impersonation struct {
+	ID        uint64     `json:"id"`
+	TokenHash string     `json:"-"`
+	AdminID   uint64     `json:"admin_id"`
+	UserID    uint64     `json:"user_id"`
+	Reason    string     `json:"reason"`
+	Created   time.Time  `json:"created"`
+	Expire    time.Time  `json:"expire"`
+	Ended     *time.Time `json:"ended"`
+}
+
+// Actions recorded in the impersonation audit trail.
+const (
+	AuditStart   = "start"
+	AuditStop    = "stop"
+	AuditRequest = "request"
+)
+
+// ImpersonationAudit records something an administrator did while or by
+// impersonating a user. Method, Path and Status are set for requests.
+type ImpersonationAudit struct {
+	ID              uint64    `json:"id"`
+	ImpersonationID uint64    `json:"impersonation_id"`
+	AdminID         uint64    `json:"admin_id"`
+	UserID          uint64    `json:"user_id"`
+	Action          string    `json:"action"`
+	Method          string    `json:"method,omitempty"`
+	Path            string    `json:"path,omitempty"`
+	Status          int       `json:"status,omitempty"`
+	Created         time.Time `json:"created"`
+}
+
+// AuthEvent is an entry of the security log. UserID is nil for failed logins
+// with an unknown email.
+type AuthEvent struct {
+	ID     uint64  `json:"id"`
+	UserID *uint64 `json:"user_id"`
+	// Email is the address that was used, which may not belong to any user.
+	Email   string `json:"email"`
+	Type    string `json:"type"`
+	Outcome string `json:"outcome"`
+	// Reason is the error code of a failure.
+	Reason    string    `json:"reason,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Created   time.Time `json:"created"`
+}
+
+// Types of auth events.
+const (
+	EventLogin               = "login"
+	EventLogout              = "logout"
+	EventPasswordChange      = "password_change"
+	EventPasswordReset       = "password_reset"
+	EventEmailChange         = "email_change"
+	EventTwoFactorEnable     = "two_factor_enable"
+	EventTwoFactorDisable    = "two_factor_disable"
+	EventSessionRevoke       = "session_revoke"
+	EventPersonalTokenRevoke = "personal_token_revoke"
+)
+
+// Outcomes of auth events.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// AuthEventFilter narrows a search of the security log. Zero values match
+// every event.
+type AuthEventFilter struct {
+	UserID  uint64
+	Email   string
+	Type    string
+	Outcome string
+	IP      string
+	// Since and Until bound the creation time, Until exclusively.
+	Since *time.Time
+	Until *time.Time
+}
+
+type AuthEventData struct {
+	Items      []AuthEvent `json:"items"`
+	Pagination Pagination  `json:"pagination"`
 }
 
 type Todo struct {